@@ -0,0 +1,171 @@
+package backoff
+
+import (
+	"flag"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/videocoin/common/instrument/registry"
+)
+
+// RetryBudgetConfig configures a RetryBudget.
+type RetryBudgetConfig struct {
+	Ratio               float64 `yaml:"ratio"`
+	MinRetriesPerSecond float64 `yaml:"min_retries_per_second"`
+	MaxTokens           float64 `yaml:"max_tokens"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given
+// FlagSet, with the given prefix.
+func (cfg *RetryBudgetConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.Float64Var(&cfg.Ratio, prefix+"retry-budget.ratio", 0.1, "Retries allowed for each successful call.")
+	f.Float64Var(&cfg.MinRetriesPerSecond, prefix+"retry-budget.min-retries-per-second", 10, "Retries allowed per second regardless of the number of successful calls.")
+	f.Float64Var(&cfg.MaxTokens, prefix+"retry-budget.max-tokens", 100, "Maximum number of retries the budget can save up.")
+}
+
+// RetryBudget limits retries to a ratio of successful calls, plus a minimum
+// rate, so that callers cannot amplify an outage by retrying at full rate.
+// Successful calls deposit Ratio tokens in a bucket, and each retry takes one;
+// when the bucket is empty, retries are denied.  The bucket is also refilled
+// over time at MinRetriesPerSecond, up to one second's worth.
+//
+// A RetryBudget is safe for concurrent use, and is meant to be shared, e.g. by
+// all the callers of a backend.
+type RetryBudget struct {
+	cfg   RetryBudgetConfig
+	clock Clock
+
+	mtx        sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+
+	tokensGauge   prometheus.Gauge
+	deniedCounter prometheus.Counter
+}
+
+// NewRetryBudget makes a new RetryBudget.  Its metrics are labelled with name
+// and registered with reg, or the default Prometheus registry if reg is nil.
+func NewRetryBudget(name string, cfg RetryBudgetConfig, reg prometheus.Registerer) *RetryBudget {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	tokens := registry.RegisterOrGet(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "retry_budget_tokens",
+		Help: "Number of retries the retry budget currently allows.",
+	}, []string{"name"})).(*prometheus.GaugeVec)
+	denied := registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "retry_budget_denied_total",
+		Help: "Total number of retries denied by the retry budget.",
+	}, []string{"name"})).(*prometheus.CounterVec)
+
+	b := &RetryBudget{
+		cfg:           cfg,
+		clock:         SystemClock,
+		tokens:        math.Min(cfg.MinRetriesPerSecond, cfg.MaxTokens),
+		tokensGauge:   tokens.WithLabelValues(name),
+		deniedCounter: denied.WithLabelValues(name),
+	}
+	b.lastRefill = b.clock.Now()
+	b.tokensGauge.Set(b.tokens)
+	return b
+}
+
+// SetClock sets the clock used to refill the budget, and restarts refilling
+// from its current time.
+func (b *RetryBudget) SetClock(c Clock) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.clock = c
+	b.lastRefill = c.Now()
+}
+
+// Succeeded deposits tokens for a successful call.
+func (b *RetryBudget) Succeeded() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill()
+	b.tokens = math.Min(b.tokens+b.cfg.Ratio, b.cfg.MaxTokens)
+	b.tokensGauge.Set(b.tokens)
+}
+
+// TryRetry takes a token for a retry, and returns false if there is none
+// left, in which case the caller should not retry.
+func (b *RetryBudget) TryRetry() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		b.deniedCounter.Inc()
+		return false
+	}
+	b.tokens--
+	b.tokensGauge.Set(b.tokens)
+	return true
+}
+
+// Tokens returns the number of retries currently allowed.
+func (b *RetryBudget) Tokens() float64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill()
+	return b.tokens
+}
+
+// refill at MinRetriesPerSecond, but only up to one second's worth, so that
+// quiet periods do not save up a burst of retries.
+func (b *RetryBudget) refill() {
+	now := b.clock.Now()
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.lastRefill = now
+
+	floor := math.Min(b.cfg.MinRetriesPerSecond, b.cfg.MaxTokens)
+	if b.tokens < floor {
+		b.tokens = math.Min(b.tokens+elapsed*b.cfg.MinRetriesPerSecond, floor)
+		b.tokensGauge.Set(b.tokens)
+	}
+}
+
+// Policy wraps policy so that every retry it allows also has to be allowed by
+// the budget.  Retry, RetryContext and ConcurrentRetrier report successful
+// calls made with the returned policy to the budget; wrap the outermost
+// policy, e.g. a ChainedRetryPolicy rather than its phases.
+func (b *RetryBudget) Policy(policy RetryPolicy) RetryPolicy {
+	return &budgetedPolicy{
+		policy: policy,
+		budget: b,
+	}
+}
+
+type budgetedPolicy struct {
+	policy RetryPolicy
+	budget *RetryBudget
+}
+
+// ComputeNextDelay returns the next delay interval.
+func (p *budgetedPolicy) ComputeNextDelay(elapsedTime time.Duration, numAttempts int) time.Duration {
+	return p.spend(p.policy.ComputeNextDelay(elapsedTime, numAttempts))
+}
+
+func (p *budgetedPolicy) computeNextDelayFrom(previous, elapsedTime time.Duration, numAttempts int) time.Duration {
+	return p.spend(nextDelay(p.policy, previous, elapsedTime, numAttempts))
+}
+
+// spend a token on the next retry, if it is allowed.
+func (p *budgetedPolicy) spend(next time.Duration) time.Duration {
+	if next == done || !p.budget.TryRetry() {
+		return done
+	}
+	return next
+}
+
+// RecordSuccess reports a successful call to the budget, if policy is one
+// returned by RetryBudget.Policy.  Retry loops other than the ones of this
+// package should call it.
+func RecordSuccess(policy RetryPolicy) {
+	if p, ok := policy.(*budgetedPolicy); ok {
+		p.budget.Succeeded()
+	}
+}
@@ -0,0 +1,81 @@
+package backoff
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBudget(t *testing.T, cfg RetryBudgetConfig) (*RetryBudget, *FakeClock, *prometheus.Registry) {
+	reg := prometheus.NewRegistry()
+	b := NewRetryBudget("test", cfg, reg)
+	clock := NewFakeClock(time.Now())
+	b.SetClock(clock)
+	return b, clock, reg
+}
+
+func TestRetryBudget(t *testing.T) {
+	b, clock, reg := newTestBudget(t, RetryBudgetConfig{Ratio: 0.5, MinRetriesPerSecond: 2, MaxTokens: 3})
+
+	// Starts with the minimum.
+	assert.True(t, b.TryRetry())
+	assert.True(t, b.TryRetry())
+	assert.False(t, b.TryRetry())
+
+	// Successes deposit tokens, up to the maximum.
+	for i := 0; i < 10; i++ {
+		b.Succeeded()
+	}
+	assert.Equal(t, 3.0, b.Tokens())
+	for i := 0; i < 3; i++ {
+		assert.True(t, b.TryRetry())
+	}
+	assert.False(t, b.TryRetry())
+
+	// Time refills the bucket, but only up to the minimum rate.
+	clock.Advance(250 * time.Millisecond)
+	assert.Equal(t, 0.5, b.Tokens())
+	clock.Advance(time.Hour)
+	assert.Equal(t, 2.0, b.Tokens())
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(b.deniedCounter))
+	n, err := testutil.GatherAndCount(reg, "retry_budget_tokens", "retry_budget_denied_total")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestRetryBudgetPolicy(t *testing.T) {
+	b, _, _ := newTestBudget(t, RetryBudgetConfig{Ratio: 1, MinRetriesPerSecond: 1, MaxTokens: 10})
+	policy := b.Policy(NewConstantRetryPolicy(time.Millisecond))
+
+	// The first retry uses the initial token, the second one is denied.
+	attempts := 0
+	err := Retry(func() error {
+		attempts++
+		return errors.New("fail")
+	}, policy, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 2, attempts)
+
+	// Successes make up for it.
+	require.NoError(t, Retry(func() error { return nil }, policy, nil))
+	assert.Equal(t, 1.0, b.Tokens())
+
+	// Errors which are not retryable do not spend tokens.
+	err = Retry(func() error { return errors.New("fatal") }, policy, func(error) bool { return false })
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, b.Tokens())
+
+	retrier := NewConcurrentRetrier(policy)
+	retrier.Failed()
+	assert.True(t, retrier.TryThrottle())
+	assert.False(t, retrier.TryThrottle())
+	retrier.Succeeded()
+	assert.True(t, retrier.TryThrottle())
+	assert.Equal(t, 1.0, b.Tokens())
+}
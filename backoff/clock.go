@@ -0,0 +1,221 @@
+package backoff
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Timer is the interface of time.Timer, as returned by Clock.NewTimer.
+	Timer interface {
+		C() <-chan time.Time
+		Stop() bool
+		Reset(d time.Duration) bool
+	}
+
+	// Ticker is the interface of time.Ticker, as returned by Clock.NewTicker.
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	// FakeClock is a Clock whose time only moves when Advance is called, so
+	// that tests do not have to actually wait.  It is safe for concurrent use.
+	FakeClock struct {
+		mtx     sync.Mutex
+		cond    *sync.Cond
+		now     time.Time
+		waiters []*fakeTimer
+	}
+
+	fakeTimer struct {
+		clock    *FakeClock
+		c        chan time.Time
+		deadline time.Time
+		period   time.Duration
+	}
+
+	fakeTicker struct {
+		*fakeTimer
+	}
+
+	realTimer struct {
+		*time.Timer
+	}
+
+	realTicker struct {
+		*time.Ticker
+	}
+)
+
+// Sleep pauses the current goroutine for at least d.
+func (t systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// After waits for d to elapse and then sends the current time on the returned
+// channel.
+func (t systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// NewTimer creates a new Timer that sends the current time on its channel
+// after at least d.
+func (t systemClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// NewTicker returns a new Ticker that sends the current time on its channel
+// every d.
+func (t systemClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// NewFakeClock makes a new FakeClock, set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mtx)
+	return c
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+// Sleep blocks until the clock has been advanced by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// After returns a channel which receives the fake time once the clock has
+// been advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer returns a Timer which fires once the clock has been advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.newTimer(d, 0)
+}
+
+// NewTicker returns a Ticker which fires every time the clock has been
+// advanced by d.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.newTimer(d, d)}
+}
+
+func (c *FakeClock) newTimer(d, period time.Duration) *fakeTimer {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	t := &fakeTimer{
+		clock:    c,
+		c:        make(chan time.Time, 1),
+		deadline: c.now.Add(d),
+		period:   period,
+	}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.addLocked(t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers which
+// are due, in order.  Like time.Ticker, tickers drop ticks if they are not
+// read fast enough.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	end := c.now.Add(d)
+	for len(c.waiters) > 0 && !c.waiters[0].deadline.After(end) {
+		t := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		c.now = t.deadline
+		select {
+		case t.c <- c.now:
+		default:
+		}
+		if t.period > 0 {
+			t.deadline = t.deadline.Add(t.period)
+			c.addLocked(t)
+		}
+	}
+	c.now = end
+}
+
+// BlockUntil blocks until at least n timers, tickers or sleepers are waiting
+// on the clock, so that tests can advance it once the code under test is
+// ready.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *FakeClock) addLocked(t *fakeTimer) {
+	c.waiters = append(c.waiters, t)
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+	c.cond.Broadcast()
+}
+
+// removeLocked returns true if t was waiting.
+func (c *FakeClock) removeLocked(t *fakeTimer) bool {
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mtx.Lock()
+	defer t.clock.mtx.Unlock()
+	return t.clock.removeLocked(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mtx.Lock()
+	defer t.clock.mtx.Unlock()
+	active := t.clock.removeLocked(t)
+	t.deadline = t.clock.now.Add(d)
+	if d <= 0 {
+		select {
+		case t.c <- t.clock.now:
+		default:
+		}
+		return active
+	}
+	t.clock.addLocked(t)
+	return active
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
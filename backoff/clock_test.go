@@ -0,0 +1,93 @@
+package backoff
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fired(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeClockTimers(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+
+	timer := clock.NewTimer(time.Second)
+	after := clock.After(2 * time.Second)
+	ticker := clock.NewTicker(time.Second)
+	stopped := clock.NewTimer(time.Second)
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	clock.Advance(999 * time.Millisecond)
+	assert.False(t, fired(timer.C()))
+	assert.False(t, fired(ticker.C()))
+
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-timer.C())
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+	assert.False(t, fired(after))
+	assert.False(t, fired(stopped.C()))
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-after)
+	assert.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	assert.False(t, fired(timer.C()))
+
+	// Reset timers fire again; stopped tickers do not.
+	assert.False(t, timer.Reset(time.Second))
+	ticker.Stop()
+	clock.Advance(time.Second)
+	assert.True(t, fired(timer.C()))
+	assert.False(t, fired(ticker.C()))
+	assert.Equal(t, start.Add(3*time.Second), clock.Now())
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Hour)
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	<-done
+}
+
+func TestRetryWithClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	policy := NewConstantRetryPolicy(time.Hour)
+	policy.SetExpirationInterval(NoInterval)
+	policy.SetMaximumInterval(NoInterval)
+
+	attempts := 0
+	result := make(chan error)
+	go func() {
+		result <- RetryWithClock(func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("fail")
+			}
+			return nil
+		}, policy, nil, clock)
+	}()
+
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+	}
+	require.NoError(t, <-result)
+	assert.Equal(t, 3, attempts)
+}
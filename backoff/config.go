@@ -0,0 +1,180 @@
+package backoff
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Kinds of RetryConfig.
+const (
+	RetryKindExponential = "exponential"
+	RetryKindConstant    = "constant"
+	RetryKindLinear      = "linear"
+)
+
+// Jitter modes of RetryConfig.  They only apply to exponential retries; the
+// default jitter of ExponentialRetryPolicy waits between 80% and 100% of the
+// computed interval, and constant and linear retries are not jittered.
+const (
+	JitterDefault      = "default"
+	JitterFull         = "full"
+	JitterEqual        = "equal"
+	JitterDecorrelated = "decorrelated"
+)
+
+// RetryConfig configures a RetryPolicy, see NewRetryPolicyFromConfig.
+type RetryConfig struct {
+	Kind               string        `yaml:"kind"`
+	InitialInterval    time.Duration `yaml:"initial_interval"`
+	BackoffCoefficient float64       `yaml:"backoff_coefficient"`
+	Increment          time.Duration `yaml:"increment"`
+	MaximumInterval    time.Duration `yaml:"maximum_interval"`
+	ExpirationInterval time.Duration `yaml:"expiration_interval"`
+	MaximumAttempts    int           `yaml:"maximum_attempts"`
+	Jitter             string        `yaml:"jitter"`
+
+	// Phases make a ChainedRetryPolicy; the other fields are then ignored.
+	// They can only be set in YAML.
+	Phases []RetryPhaseConfig `yaml:"phases"`
+}
+
+// RetryPhaseConfig configures a phase of a ChainedRetryPolicy.  Fields left
+// out of the YAML take the defaults of the flags.
+type RetryPhaseConfig struct {
+	RetryConfig `yaml:",inline"`
+	Attempts    int `yaml:"attempts"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (cfg *RetryPhaseConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	cfg.RegisterFlags("", flag.NewFlagSet("", flag.PanicOnError))
+	type plain RetryPhaseConfig
+	return unmarshal((*plain)(cfg))
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet,
+// with the given prefix.
+func (cfg *RetryConfig) RegisterFlags(prefix string, f *flag.FlagSet) {
+	f.StringVar(&cfg.Kind, prefix+"retry.kind", RetryKindExponential, "Kind of retries: exponential, constant or linear.")
+	f.DurationVar(&cfg.InitialInterval, prefix+"retry.initial-interval", 100*time.Millisecond, "Interval before the first retry, or between all retries for constant retries.")
+	f.Float64Var(&cfg.BackoffCoefficient, prefix+"retry.backoff-coefficient", defaultBackoffCoefficient, "Factor by which exponential retry intervals grow.")
+	f.DurationVar(&cfg.Increment, prefix+"retry.increment", 100*time.Millisecond, "Amount by which linear retry intervals grow.")
+	f.DurationVar(&cfg.MaximumInterval, prefix+"retry.max-interval", defaultMaximumInterval, "Maximum interval between retries; 0 for no maximum.")
+	f.DurationVar(&cfg.ExpirationInterval, prefix+"retry.expiration", defaultExpirationInterval, "Time after which to stop retrying; 0 to retry until max-attempts.")
+	f.IntVar(&cfg.MaximumAttempts, prefix+"retry.max-attempts", defaultMaximumAttempts, "Maximum number of retries; 0 for no maximum.")
+	f.StringVar(&cfg.Jitter, prefix+"retry.jitter", JitterDefault, "Jitter of exponential retries: default, full, equal or decorrelated.")
+}
+
+// Validate the config.
+func (cfg *RetryConfig) Validate() error {
+	if len(cfg.Phases) > 0 {
+		for i, phase := range cfg.Phases {
+			if len(phase.Phases) > 0 {
+				return fmt.Errorf("retry phase %d: phases cannot be nested", i)
+			}
+			if phase.Attempts < 0 || (phase.Attempts == 0 && i < len(cfg.Phases)-1) {
+				return fmt.Errorf("retry phase %d: attempts must be positive, except for the last phase", i)
+			}
+			if err := phase.RetryConfig.Validate(); err != nil {
+				return fmt.Errorf("retry phase %d: %v", i, err)
+			}
+		}
+		return nil
+	}
+
+	switch cfg.Kind {
+	case RetryKindExponential:
+		switch cfg.Jitter {
+		case "", JitterDefault, JitterFull, JitterEqual:
+			if cfg.BackoffCoefficient < 1 {
+				return fmt.Errorf("retry backoff coefficient must be at least 1, got %v", cfg.BackoffCoefficient)
+			}
+		case JitterDecorrelated:
+		default:
+			return fmt.Errorf("unknown retry jitter %q", cfg.Jitter)
+		}
+	case RetryKindLinear:
+		if cfg.Increment < 0 {
+			return fmt.Errorf("retry increment must not be negative, got %v", cfg.Increment)
+		}
+		fallthrough
+	case RetryKindConstant:
+		if cfg.Jitter != "" && cfg.Jitter != JitterDefault {
+			return fmt.Errorf("retry jitter %q only applies to exponential retries", cfg.Jitter)
+		}
+	default:
+		return fmt.Errorf("unknown retry kind %q", cfg.Kind)
+	}
+
+	if cfg.InitialInterval <= 0 {
+		return fmt.Errorf("retry initial interval must be positive, got %v", cfg.InitialInterval)
+	}
+	if cfg.MaximumInterval < 0 || (cfg.MaximumInterval > 0 && cfg.MaximumInterval < cfg.InitialInterval) {
+		return fmt.Errorf("retry maximum interval must be 0 or at least the initial interval, got %v", cfg.MaximumInterval)
+	}
+	if cfg.ExpirationInterval < 0 {
+		return fmt.Errorf("retry expiration interval must not be negative, got %v", cfg.ExpirationInterval)
+	}
+	if cfg.MaximumAttempts < 0 {
+		return fmt.Errorf("retry maximum attempts must not be negative, got %v", cfg.MaximumAttempts)
+	}
+	return nil
+}
+
+// NewRetryPolicyFromConfig validates cfg, and returns the RetryPolicy it
+// describes.
+func NewRetryPolicyFromConfig(cfg RetryConfig) (RetryPolicy, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return newRetryPolicy(cfg), nil
+}
+
+// newRetryPolicy builds a validated config.
+func newRetryPolicy(cfg RetryConfig) RetryPolicy {
+	if len(cfg.Phases) > 0 {
+		phases := make([]RetryPhase, 0, len(cfg.Phases))
+		for _, phase := range cfg.Phases {
+			phases = append(phases, RetryPhase{
+				Policy:   newRetryPolicy(phase.RetryConfig),
+				Attempts: phase.Attempts,
+			})
+		}
+		return NewChainedRetryPolicy(phases...)
+	}
+
+	var policy interface {
+		RetryPolicy
+		SetMaximumInterval(time.Duration)
+		SetExpirationInterval(time.Duration)
+		SetMaximumAttempts(int)
+	}
+	switch cfg.Kind {
+	case RetryKindConstant:
+		policy = NewConstantRetryPolicy(cfg.InitialInterval)
+	case RetryKindLinear:
+		policy = NewLinearRetryPolicy(cfg.InitialInterval, cfg.Increment)
+	default:
+		switch cfg.Jitter {
+		case JitterFull:
+			p := NewFullJitterRetryPolicy(cfg.InitialInterval)
+			p.SetBackoffCoefficient(cfg.BackoffCoefficient)
+			policy = p
+		case JitterEqual:
+			p := NewEqualJitterRetryPolicy(cfg.InitialInterval)
+			p.SetBackoffCoefficient(cfg.BackoffCoefficient)
+			policy = p
+		case JitterDecorrelated:
+			policy = NewDecorrelatedJitterRetryPolicy(cfg.InitialInterval)
+		default:
+			p := NewExponentialRetryPolicy(cfg.InitialInterval)
+			p.SetBackoffCoefficient(cfg.BackoffCoefficient)
+			policy = p
+		}
+	}
+	policy.SetMaximumInterval(cfg.MaximumInterval)
+	policy.SetExpirationInterval(cfg.ExpirationInterval)
+	policy.SetMaximumAttempts(cfg.MaximumAttempts)
+	return policy
+}
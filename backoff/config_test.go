@@ -0,0 +1,117 @@
+package backoff
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func defaultRetryConfig() RetryConfig {
+	var cfg RetryConfig
+	cfg.RegisterFlags("test.", flag.NewFlagSet("", flag.PanicOnError))
+	return cfg
+}
+
+func TestRetryConfigFlags(t *testing.T) {
+	var cfg RetryConfig
+	f := flag.NewFlagSet("", flag.PanicOnError)
+	cfg.RegisterFlags("client.", f)
+	require.NoError(t, f.Parse([]string{
+		"-client.retry.kind=linear",
+		"-client.retry.initial-interval=1s",
+		"-client.retry.increment=2s",
+		"-client.retry.max-interval=0",
+		"-client.retry.expiration=0",
+		"-client.retry.max-attempts=3",
+	}))
+
+	policy, err := NewRetryPolicyFromConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, done}, nextBackOffs(policy, 5))
+}
+
+func TestRetryConfigYAML(t *testing.T) {
+	cfg := defaultRetryConfig()
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`
+phases:
+  - kind: constant
+    initial_interval: 10ms
+    attempts: 2
+  - initial_interval: 1s
+    expiration_interval: 0s
+    maximum_interval: 4s
+    maximum_attempts: 4
+    jitter: equal
+`), &cfg))
+
+	policy, err := NewRetryPolicyFromConfig(cfg)
+	require.NoError(t, err)
+	chained := policy.(*ChainedRetryPolicy)
+	chained.phases[1].Policy.(*EqualJitterRetryPolicy).SetRandSource(fixedRand(1))
+	assert.Equal(t, []time.Duration{
+		10 * time.Millisecond,
+		10 * time.Millisecond,
+		time.Second - time.Nanosecond,
+		2*time.Second - time.Nanosecond,
+		4*time.Second - time.Nanosecond,
+		4*time.Second - time.Nanosecond,
+		done,
+	}, nextBackOffs(policy, 10))
+}
+
+func TestRetryConfigKinds(t *testing.T) {
+	for _, tc := range []struct {
+		kind, jitter string
+		expected     RetryPolicy
+	}{
+		{RetryKindExponential, JitterDefault, &ExponentialRetryPolicy{}},
+		{RetryKindExponential, JitterFull, &FullJitterRetryPolicy{}},
+		{RetryKindExponential, JitterEqual, &EqualJitterRetryPolicy{}},
+		{RetryKindExponential, JitterDecorrelated, &DecorrelatedJitterRetryPolicy{}},
+		{RetryKindConstant, JitterDefault, &ConstantRetryPolicy{}},
+		{RetryKindLinear, "", &LinearRetryPolicy{}},
+	} {
+		cfg := defaultRetryConfig()
+		cfg.Kind, cfg.Jitter = tc.kind, tc.jitter
+		policy, err := NewRetryPolicyFromConfig(cfg)
+		require.NoError(t, err, tc.kind+" "+tc.jitter)
+		assert.IsType(t, tc.expected, policy, tc.kind+" "+tc.jitter)
+	}
+}
+
+func TestRetryConfigValidate(t *testing.T) {
+	for name, modify := range map[string]func(*RetryConfig){
+		"unknown kind":          func(cfg *RetryConfig) { cfg.Kind = "random" },
+		"unknown jitter":        func(cfg *RetryConfig) { cfg.Jitter = "lots" },
+		"jitter of constant":    func(cfg *RetryConfig) { cfg.Kind, cfg.Jitter = RetryKindConstant, JitterFull },
+		"zero initial interval": func(cfg *RetryConfig) { cfg.InitialInterval = 0 },
+		"small coefficient":     func(cfg *RetryConfig) { cfg.BackoffCoefficient = 0.5 },
+		"negative increment":    func(cfg *RetryConfig) { cfg.Kind, cfg.Increment = RetryKindLinear, -time.Second },
+		"small max interval":    func(cfg *RetryConfig) { cfg.MaximumInterval = time.Millisecond },
+		"negative expiration":   func(cfg *RetryConfig) { cfg.ExpirationInterval = -time.Second },
+		"negative max attempts": func(cfg *RetryConfig) { cfg.MaximumAttempts = -1 },
+		"unlimited first phase": func(cfg *RetryConfig) {
+			cfg.Phases = []RetryPhaseConfig{{RetryConfig: defaultRetryConfig()}, {RetryConfig: defaultRetryConfig()}}
+		},
+		"nested phases": func(cfg *RetryConfig) {
+			nested := defaultRetryConfig()
+			nested.Phases = []RetryPhaseConfig{{RetryConfig: defaultRetryConfig()}}
+			cfg.Phases = []RetryPhaseConfig{{RetryConfig: nested}}
+		},
+		"invalid phase": func(cfg *RetryConfig) {
+			invalid := defaultRetryConfig()
+			invalid.Kind = ""
+			cfg.Phases = []RetryPhaseConfig{{RetryConfig: invalid}}
+		},
+	} {
+		cfg := defaultRetryConfig()
+		require.NoError(t, cfg.Validate())
+		modify(&cfg)
+		_, err := NewRetryPolicyFromConfig(cfg)
+		assert.Error(t, err, name)
+	}
+}
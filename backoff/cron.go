@@ -21,7 +21,10 @@
 package backoff
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/robfig/cron"
@@ -32,38 +35,130 @@ import (
 // NoBackoff is used to represent backoff when no cron backoff is needed
 const NoBackoff = time.Duration(-1)
 
+var (
+	// ErrEmptySchedule is returned for empty cron schedules.
+	ErrEmptySchedule = errors.New("empty cron schedule")
+	// ErrScheduleNeverFires is returned for cron schedules which have no
+	// upcoming fire time, e.g. "0 0 30 2 *".
+	ErrScheduleNeverFires = errors.New("cron schedule never fires")
+)
+
+var (
+	minuteParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	secondParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+)
+
+// locationSchedule evaluates a cron schedule in a time zone.
+type locationSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+// Next returns the next fire time after t, in the schedule's time zone.
+func (s locationSchedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t.In(s.location))
+}
+
+// ParseSchedule parses a cron schedule.  It accepts
+//   - standard specs with five fields, e.g. "0 9 * * 1-5",
+//   - specs with a leading seconds field, e.g. "*/15 * * * * *",
+//   - descriptors, e.g. "@daily" or "@every 1h30m",
+//
+// each optionally prefixed with a time zone, e.g. "CRON_TZ=Europe/Berlin 0 9 * * *"
+// or "TZ=America/New_York @daily".  Schedules without a time zone are
+// evaluated in UTC.
+func ParseSchedule(cronSchedule string) (cron.Schedule, error) {
+	spec := strings.TrimSpace(cronSchedule)
+	if spec == "" {
+		return nil, ErrEmptySchedule
+	}
+
+	location := time.UTC
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		fields := strings.SplitN(spec, " ", 2)
+		name := fields[0][strings.Index(fields[0], "=")+1:]
+		var err error
+		if location, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %v", name, err)
+		}
+		if len(fields) < 2 {
+			return nil, ErrEmptySchedule
+		}
+		spec = strings.TrimSpace(fields[1])
+	}
+
+	parser := minuteParser
+	if !strings.HasPrefix(spec, "@") && len(strings.Fields(spec)) == 6 {
+		parser = secondParser
+	}
+	schedule, err := parser.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	return locationSchedule{schedule: schedule, location: location}, nil
+}
+
 // ValidateSchedule validates a cron schedule spec
 func ValidateSchedule(cronSchedule string) error {
 	if cronSchedule == "" {
 		return nil
 	}
-	if _, err := cron.ParseStandard(cronSchedule); err != nil {
-		return &types.BadRequestError{Message: "Invalid CronSchedule."}
+	if _, err := ParseSchedule(cronSchedule); err != nil {
+		return &types.BadRequestError{Message: fmt.Sprintf("Invalid CronSchedule: %v.", err)}
 	}
 	return nil
 }
 
-// GetBackoffForNextSchedule calculates the backoff time for the next run given
-// a cronSchedule, workflow start time and workflow close time
-func GetBackoffForNextSchedule(cronSchedule string, startTime time.Time, closeTime time.Time) time.Duration {
-	if len(cronSchedule) == 0 {
-		return NoBackoff
+// NextFireTimes returns the next n fire times of a cron schedule after from,
+// e.g. to show users when a schedule they are editing will run.  Fewer times
+// are returned if the schedule stops firing.
+func NextFireTimes(cronSchedule string, from time.Time, n int) ([]time.Time, error) {
+	schedule, err := ParseSchedule(cronSchedule)
+	if err != nil {
+		return nil, err
+	}
+	times := make([]time.Time, 0, n)
+	for next := from; len(times) < n; {
+		if next = schedule.Next(next); next.IsZero() {
+			if len(times) == 0 {
+				return nil, ErrScheduleNeverFires
+			}
+			break
+		}
+		times = append(times, next)
 	}
+	return times, nil
+}
 
-	schedule, err := cron.ParseStandard(cronSchedule)
+// NextScheduleBackoff calculates the backoff time for the next run given a
+// cronSchedule, workflow start time and workflow close time.
+func NextScheduleBackoff(cronSchedule string, startTime time.Time, closeTime time.Time) (time.Duration, error) {
+	schedule, err := ParseSchedule(cronSchedule)
 	if err != nil {
-		return NoBackoff
+		return 0, err
 	}
-	startUTCTime := startTime.In(time.UTC)
-	closeUTCTime := closeTime.In(time.UTC)
-	nextScheduleTime := schedule.Next(startUTCTime)
+	nextScheduleTime := schedule.Next(startTime)
 	// Calculate the next schedule start time which is nearest to the close time
-	for nextScheduleTime.Before(closeUTCTime) {
+	for !nextScheduleTime.IsZero() && nextScheduleTime.Before(closeTime) {
 		nextScheduleTime = schedule.Next(nextScheduleTime)
 	}
-	backoffInterval := nextScheduleTime.Sub(closeUTCTime)
-	roundedInterval := time.Second * time.Duration(math.Ceil(backoffInterval.Seconds()))
-	return roundedInterval
+	if nextScheduleTime.IsZero() {
+		return 0, ErrScheduleNeverFires
+	}
+	backoffInterval := nextScheduleTime.Sub(closeTime)
+	return time.Second * time.Duration(math.Ceil(backoffInterval.Seconds())), nil
+}
+
+// GetBackoffForNextSchedule calculates the backoff time for the next run given
+// a cronSchedule, workflow start time and workflow close time.  It returns
+// NoBackoff if the schedule is empty or invalid; use NextScheduleBackoff to
+// tell why.
+func GetBackoffForNextSchedule(cronSchedule string, startTime time.Time, closeTime time.Time) time.Duration {
+	backoff, err := NextScheduleBackoff(cronSchedule, startTime, closeTime)
+	if err != nil {
+		return NoBackoff
+	}
+	return backoff
 }
 
 // GetBackoffForNextScheduleInSeconds calculates the backoff time in seconds for the
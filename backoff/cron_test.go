@@ -47,6 +47,12 @@ var crontests = []struct {
 	{"@every 5h", "2018-12-17T08:00:00+00:00", "2018-12-17T09:00:00+00:00", time.Hour * 4},
 	{"@every 5h", "2018-12-17T08:00:00+00:00", "2018-12-18T00:00:00+00:00", time.Hour * 4},
 	{"0 3 * * 0-6", "2018-12-17T08:00:00-08:00", "", time.Hour * 11},
+	{"*/15 * * * * *", "2018-12-17T08:08:18+00:00", "", time.Second * 12},
+	{"CRON_TZ=Europe/Berlin 0 9 * * *", "2018-12-17T07:00:00+00:00", "", time.Hour},
+	{"TZ=America/New_York 0 9 * * *", "2018-12-17T08:00:00-05:00", "", time.Hour},
+	{"TZ=America/New_York 0 9 * * *", "2018-12-17T09:00:00+00:00", "", time.Hour * 5},
+	{"CRON_TZ=Nowhere/Special 0 9 * * *", "2018-12-17T07:00:00+00:00", "", NoBackoff},
+	{"0 0 30 2 *", "2018-12-17T07:00:00+00:00", "", NoBackoff},
 }
 
 func TestCron(t *testing.T) {
@@ -66,3 +72,43 @@ func TestCron(t *testing.T) {
 		})
 	}
 }
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{"", " ", "CRON_TZ=UTC", "CRON_TZ=Nowhere/Special * * * * *", "* * * *", "* * * * * * *", "@sometimes"} {
+		_, err := ParseSchedule(spec)
+		assert.Error(t, err, spec)
+		assert.Error(t, ValidateSchedule(spec+"x"), spec)
+	}
+
+	_, err := NextScheduleBackoff("", time.Now(), time.Now())
+	assert.Equal(t, ErrEmptySchedule, err)
+	_, err = NextScheduleBackoff("0 0 30 2 *", time.Now(), time.Now())
+	assert.Equal(t, ErrScheduleNeverFires, err)
+}
+
+func TestNextFireTimes(t *testing.T) {
+	from := time.Date(2019, 3, 30, 12, 0, 0, 0, time.UTC)
+
+	times, err := NextFireTimes("CRON_TZ=Europe/Berlin 0 9 * * *", from, 3)
+	assert.NoError(t, err)
+	// Berlin switches to summer time on 2019-03-31.
+	assert.Equal(t, []time.Time{
+		time.Date(2019, 3, 31, 7, 0, 0, 0, time.UTC),
+		time.Date(2019, 4, 1, 7, 0, 0, 0, time.UTC),
+		time.Date(2019, 4, 2, 7, 0, 0, 0, time.UTC),
+	}, utc(times))
+
+	times, err = NextFireTimes("@every 90s", from, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{from.Add(90 * time.Second), from.Add(180 * time.Second)}, utc(times))
+
+	_, err = NextFireTimes("0 0 30 2 *", from, 2)
+	assert.Equal(t, ErrScheduleNeverFires, err)
+}
+
+func utc(times []time.Time) []time.Time {
+	for i := range times {
+		times[i] = times[i].UTC()
+	}
+	return times
+}
@@ -0,0 +1,238 @@
+package backoff
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/videocoin/common/instrument/registry"
+	"github.com/videocoin/common/logging"
+)
+
+// Loop is an Interface which passes a context to its function, logs to a
+// logging.Interface, and backs off following a RetryPolicy.  Its state can be
+// observed with ConsecutiveFailures and LastError, and through metrics.
+type Loop struct {
+	name   string
+	f      func(ctx context.Context) (bool, error)
+	policy RetryPolicy
+	log    logging.Interface
+	clock  Clock
+
+	interval, maxBackoff, maxElapsed time.Duration
+
+	quit     chan struct{}
+	quitOnce sync.Once
+	done     chan struct{}
+
+	mtx                 sync.Mutex
+	consecutiveFailures int
+	lastErr             error
+
+	attempts prometheus.Counter
+	failures prometheus.Counter
+	gaveUp   prometheus.Counter
+}
+
+// NewLoop makes a new Loop, which calls f every 10 seconds until it returns
+// true.  After an error, it waits following policy, up to one minute, before
+// calling f again.  If policy is nil, waits double after each consecutive
+// error, like New.  The expiration interval of policy is not used, see
+// SetMaxElapsedTime.
+//
+// Its metrics are labelled with name and registered with reg, or the default
+// Prometheus registry if reg is nil.
+func NewLoop(name string, f func(ctx context.Context) (bool, error), policy RetryPolicy, log logging.Interface, reg prometheus.Registerer) *Loop {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	attempts := registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "backoff_loop_attempts_total",
+		Help: "Total number of calls made by backoff loops.",
+	}, []string{"name"})).(*prometheus.CounterVec)
+	failures := registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "backoff_loop_failures_total",
+		Help: "Total number of failed calls made by backoff loops.",
+	}, []string{"name"})).(*prometheus.CounterVec)
+	gaveUp := registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "backoff_loop_gave_up_total",
+		Help: "Total number of backoff loops which stopped because their policy gave up.",
+	}, []string{"name"})).(*prometheus.CounterVec)
+
+	return &Loop{
+		name:       name,
+		f:          f,
+		policy:     policy,
+		log:        logging.Named(log, "backoff").WithField("name", name),
+		clock:      SystemClock,
+		interval:   10 * time.Second,
+		maxBackoff: 60 * time.Second,
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+		attempts:   attempts.WithLabelValues(name),
+		failures:   failures.WithLabelValues(name),
+		gaveUp:     gaveUp.WithLabelValues(name),
+	}
+}
+
+// SetInitialBackoff sets the interval between successful calls, and the
+// first backoff of the default policy.
+func (l *Loop) SetInitialBackoff(d time.Duration) {
+	l.interval = d
+}
+
+// SetMaxBackoff caps the time waited after an error.
+func (l *Loop) SetMaxBackoff(d time.Duration) {
+	l.maxBackoff = d
+}
+
+// SetMaxElapsedTime makes the loop give up once it has been failing for d.
+// 0, the default, means never: as loops are usually meant to run for as long
+// as their process, the elapsed time is not passed on to the policy, so that
+// its default expiration interval does not stop the loop.
+func (l *Loop) SetMaxElapsedTime(d time.Duration) {
+	l.maxElapsed = d
+}
+
+// SetClock sets the clock used to wait between calls.
+func (l *Loop) SetClock(c Clock) {
+	l.clock = c
+}
+
+// ConsecutiveFailures returns the number of errors since the last success.
+func (l *Loop) ConsecutiveFailures() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.consecutiveFailures
+}
+
+// LastError returns the error of the last call, or nil if it succeeded.
+func (l *Loop) LastError() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.lastErr
+}
+
+// Start the loop, and block until it is done.  Start or Run can only be
+// called once.
+//
+// If the policy gives up, e.g. after its maximum attempts, or the loop has
+// been failing for longer than SetMaxElapsedTime, Start logs the error at
+// error level, counts it in backoff_loop_gave_up_total and returns; it is
+// still available from LastError, and Run returns it.
+func (l *Loop) Start() {
+	_ = l.Run(context.Background())
+}
+
+// Stop the loop, and wait for it to stop.
+func (l *Loop) Stop() {
+	l.quitOnce.Do(func() { close(l.quit) })
+	<-l.done
+}
+
+// Run the loop until its function returns true, ctx is done, Stop is called
+// or the loop gives up, see Start.  It returns ctx's error if ctx is done, or
+// the last error of the function if the loop gave up.  Successful calls are reported
+// with RecordSuccess, to refill policies returned by RetryBudget.Policy.
+// Start or Run can only be called once.
+func (l *Loop) Run(ctx context.Context) error {
+	defer close(l.done)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	policy := l.policy
+	if policy == nil {
+		exponential := NewExponentialRetryPolicy(2 * l.interval)
+		exponential.SetMaximumInterval(NoInterval)
+		exponential.SetExpirationInterval(NoInterval)
+		policy = exponential
+	}
+	var (
+		failingSince time.Time
+		previous     time.Duration
+	)
+	shouldLog := true
+
+	for {
+		if ctx.Err() != nil {
+			return l.stopped(ctx)
+		}
+
+		l.attempts.Inc()
+		finished, err := l.f(ctx)
+		if err == nil {
+			RecordSuccess(policy)
+		}
+		if finished {
+			return nil
+		}
+
+		l.mtx.Lock()
+		l.lastErr = err
+		if err == nil {
+			l.consecutiveFailures = 0
+		} else {
+			l.consecutiveFailures++
+		}
+		failures := l.consecutiveFailures
+		l.mtx.Unlock()
+
+		backoff := l.interval
+		if err != nil {
+			l.failures.Inc()
+			if failures == 1 {
+				failingSince = l.clock.Now()
+			}
+			backoff = nextDelay(policy, previous, 0, failures-1)
+			previous = backoff
+			if backoff == done || (l.maxElapsed > 0 && l.clock.Now().Sub(failingSince) >= l.maxElapsed) {
+				l.gaveUp.Inc()
+				logging.WithError(l.log, err).Errorln("Giving up after", failures, "consecutive errors")
+				return err
+			}
+			shouldLog = true
+			if backoff > l.maxBackoff {
+				backoff = l.maxBackoff
+				shouldLog = false
+			}
+		}
+
+		if shouldLog {
+			if err != nil {
+				l.log.WithFields(logging.Fields{"err": err, "backoff": backoff}).Warnln("Error, backing off")
+			} else {
+				l.log.Infoln("Success")
+			}
+		}
+		// Re-enable logging if we came from an error (suppressed or not)
+		// since we want to log in case a success follows.
+		shouldLog = err != nil
+
+		timer := l.clock.NewTimer(backoff)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return l.stopped(ctx)
+		}
+	}
+}
+
+// stopped returns the error of ctx, unless the loop was stopped by Stop.
+func (l *Loop) stopped(ctx context.Context) error {
+	select {
+	case <-l.quit:
+		return nil
+	default:
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/videocoin/common/logging"
+)
+
+var _ Interface = &Loop{}
+
+func TestLoop(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	reg := prometheus.NewPedanticRegistry()
+	errSample := errors.New("sample")
+	returns := []error{nil, errSample, nil, errSample, errSample}
+
+	var l *Loop
+	var failures []int
+	l = NewLoop("test", func(ctx context.Context) (bool, error) {
+		failures = append(failures, l.ConsecutiveFailures())
+		if len(returns) == 0 {
+			return true, nil
+		}
+		err := returns[0]
+		returns = returns[1:]
+		return false, err
+	}, NewConstantRetryPolicy(time.Millisecond), logging.Logrus(logger), reg)
+	l.SetInitialBackoff(time.Millisecond)
+	require.NoError(t, l.Run(context.Background()))
+
+	assert.Equal(t, []int{0, 0, 1, 0, 1, 2}, failures)
+	assert.Equal(t, 2, l.ConsecutiveFailures())
+	assert.Equal(t, errSample, l.LastError())
+	assert.Equal(t, 6.0, testutil.ToFloat64(l.attempts))
+	assert.Equal(t, 3.0, testutil.ToFloat64(l.failures))
+
+	var levels []logrus.Level
+	for _, entry := range hook.AllEntries() {
+		levels = append(levels, entry.Level)
+		assert.Equal(t, "test", entry.Data["name"])
+	}
+	assert.Equal(t, []logrus.Level{
+		logrus.InfoLevel, logrus.WarnLevel, logrus.InfoLevel, logrus.WarnLevel, logrus.WarnLevel,
+	}, levels)
+}
+
+func TestLoopGivesUp(t *testing.T) {
+	policy := NewConstantRetryPolicy(time.Millisecond)
+	policy.SetMaximumAttempts(2)
+	errSample := errors.New("sample")
+	calls := 0
+	l := NewLoop("gives-up", func(ctx context.Context) (bool, error) {
+		calls++
+		return false, errSample
+	}, policy, logging.Noop(), prometheus.NewPedanticRegistry())
+
+	assert.Equal(t, errSample, l.Run(context.Background()))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 3, l.ConsecutiveFailures())
+	assert.Equal(t, 1.0, testutil.ToFloat64(l.gaveUp))
+}
+
+func TestLoopMaxElapsedTime(t *testing.T) {
+	errSample := errors.New("sample")
+	for _, tc := range []struct {
+		name       string
+		maxElapsed time.Duration
+		calls      int
+		err        error
+	}{
+		// Beyond the policy's default expiration interval.
+		{name: "unlimited", calls: 10},
+		{name: "limited", maxElapsed: 30 * time.Second, calls: 4, err: errSample},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Now())
+			calls := 0
+			l := NewLoop(tc.name, func(ctx context.Context) (bool, error) {
+				calls++
+				return false, errSample
+			}, NewConstantRetryPolicy(10*time.Second), logging.Noop(), prometheus.NewPedanticRegistry())
+			l.SetClock(clock)
+			l.SetMaxElapsedTime(tc.maxElapsed)
+
+			errs := make(chan error, 1)
+			go func() { errs <- l.Run(context.Background()) }()
+			for i := 1; i < tc.calls; i++ {
+				clock.BlockUntil(1)
+				clock.Advance(10 * time.Second)
+			}
+			if tc.err == nil {
+				clock.BlockUntil(1)
+				l.Stop()
+			}
+			assert.Equal(t, tc.err, <-errs)
+			assert.Equal(t, tc.calls, calls)
+		})
+	}
+}
+
+func TestLoopCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := NewLoop("cancel", func(ctx context.Context) (bool, error) {
+		cancel()
+		<-ctx.Done()
+		return false, ctx.Err()
+	}, nil, logging.Noop(), prometheus.NewPedanticRegistry())
+
+	assert.Equal(t, context.Canceled, l.Run(ctx))
+}
+
+func TestLoopStop(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := NewLoop("stop", func(ctx context.Context) (bool, error) {
+		return false, nil
+	}, nil, logging.Noop(), prometheus.NewPedanticRegistry())
+	l.SetClock(clock)
+
+	go l.Start()
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Second)
+	clock.BlockUntil(1)
+	l.Stop()
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(l.attempts))
+}
+
+func TestLoopRecordsSuccesses(t *testing.T) {
+	b, _, _ := newTestBudget(t, RetryBudgetConfig{Ratio: 0.5, MinRetriesPerSecond: 0, MaxTokens: 10})
+	calls := 0
+	l := NewLoop("budgeted", func(ctx context.Context) (bool, error) {
+		calls++
+		return calls == 4, nil
+	}, b.Policy(NewConstantRetryPolicy(time.Millisecond)), logging.Noop(), prometheus.NewPedanticRegistry())
+	l.SetInitialBackoff(time.Millisecond)
+	require.NoError(t, l.Run(context.Background()))
+
+	// Each success refills the budget.
+	assert.Equal(t, 2.0, b.Tokens())
+}
@@ -37,8 +37,10 @@ type (
 	// requests due to out-of-quota or server busy errors.
 	ConcurrentRetrier struct {
 		sync.Mutex
-		retrier      Retrier // Backoff retrier
-		failureCount int64   // Number of consecutive failures seen
+		retrier      Retrier     // Backoff retrier
+		policy       RetryPolicy // Policy of the retrier
+		clock        Clock       // Clock to sleep with
+		failureCount int64       // Number of consecutive failures seen
 	}
 )
 
@@ -61,18 +63,38 @@ func (c *ConcurrentRetrier) throttleInternal() time.Duration {
 	}
 
 	if next != done {
-		time.Sleep(next)
+		c.clock.Sleep(next)
 	}
 
 	return next
 }
 
+// TryThrottle is like Throttle, but if there were failures since the last
+// success and the policy allows no more retries, e.g. because its RetryBudget
+// is depleted, it returns false instead, and the request should not be sent.
+func (c *ConcurrentRetrier) TryThrottle() bool {
+	c.Lock()
+	if c.failureCount == 0 {
+		c.Unlock()
+		return true
+	}
+	next := c.retrier.NextBackOff()
+	c.Unlock()
+
+	if next == done {
+		return false
+	}
+	c.clock.Sleep(next)
+	return true
+}
+
 // Succeeded marks client request succeeded.
 func (c *ConcurrentRetrier) Succeeded() {
 	defer c.Unlock()
 	c.Lock()
 	c.failureCount = 0
 	c.retrier.Reset()
+	RecordSuccess(c.policy)
 }
 
 // Failed marks client request failed because backend is busy.
@@ -84,44 +106,57 @@ func (c *ConcurrentRetrier) Failed() {
 
 // NewConcurrentRetrier returns an instance of concurrent backoff retrier.
 func NewConcurrentRetrier(retryPolicy RetryPolicy) *ConcurrentRetrier {
-	retrier := NewRetrier(retryPolicy, SystemClock)
-	return &ConcurrentRetrier{retrier: retrier}
+	return NewConcurrentRetrierWithClock(retryPolicy, SystemClock)
+}
+
+// NewConcurrentRetrierWithClock is like NewConcurrentRetrier, but uses clock
+// to sleep.
+func NewConcurrentRetrierWithClock(retryPolicy RetryPolicy, clock Clock) *ConcurrentRetrier {
+	retrier := NewRetrier(retryPolicy, clock)
+	return &ConcurrentRetrier{retrier: retrier, policy: retryPolicy, clock: clock}
 }
 
 // Retry function can be used to wrap any call with retry logic using the passed in policy
 // The returned error will be preferred to a previous one if one exists. That's because the
 // very last error is very likely a timeout error, and it's not useful for logging/troubleshooting
 func Retry(operation Operation, policy RetryPolicy, isRetryable IsRetryable) error {
+	return RetryWithClock(operation, policy, isRetryable, SystemClock)
+}
+
+// RetryWithClock is like Retry, but uses clock to sleep.
+func RetryWithClock(operation Operation, policy RetryPolicy, isRetryable IsRetryable, clock Clock) error {
 	var prevErr error
 	var err error
 	var next time.Duration
 
-	r := NewRetrier(policy, SystemClock)
+	r := NewRetrier(policy, clock)
 	for {
 		// record the previous error before an operation
 		prevErr = err
 
 		// operation completed successfully.  No need to retry.
 		if err = operation(); err == nil {
+			RecordSuccess(policy)
 			return nil
 		}
 
-		if next = r.NextBackOff(); next == done {
+		// Check if the error is retryable first, so that errors which are not
+		// do not spend a retry from a budgeted policy.
+		if isRetryable != nil && !isRetryable(err) {
 			if prevErr != nil {
 				return prevErr
 			}
 			return err
 		}
 
-		// Check if the error is retryable
-		if isRetryable != nil && !isRetryable(err) {
+		if next = r.NextBackOff(); next == done {
 			if prevErr != nil {
 				return prevErr
 			}
 			return err
 		}
 
-		time.Sleep(next)
+		clock.Sleep(next)
 	}
 }
 
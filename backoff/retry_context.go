@@ -0,0 +1,124 @@
+package backoff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type (
+	// ContextOperation to retry.  attempt starts at 1.
+	ContextOperation func(ctx context.Context, attempt int) error
+
+	// OnRetry is called after a failed attempt, before sleeping for next
+	// and retrying.
+	OnRetry func(attempt int, err error, next time.Duration)
+
+	// StopReason tells why RetryContext gave up.
+	StopReason int
+
+	// RetryError is returned by RetryContext when the operation never
+	// succeeded.
+	RetryError struct {
+		// Errors returned by each attempt, in order.
+		Errors []error
+		Reason StopReason
+		// ContextErr is the context's error if Reason is ContextDone.
+		ContextErr error
+	}
+)
+
+const (
+	// PolicyExhausted means the RetryPolicy allowed no more attempts.
+	PolicyExhausted StopReason = iota
+	// NotRetryable means the last error was not retryable.
+	NotRetryable
+	// ContextDone means the context was cancelled or hit its deadline.
+	ContextDone
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case PolicyExhausted:
+		return "retry policy exhausted"
+	case NotRetryable:
+		return "error not retryable"
+	case ContextDone:
+		return "context done"
+	default:
+		return fmt.Sprintf("StopReason(%d)", int(r))
+	}
+}
+
+// Error implements error.
+func (e *RetryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "gave up after %d attempts (%s)", len(e.Errors), e.Reason)
+	if e.ContextErr != nil {
+		fmt.Fprintf(&b, ": %v", e.ContextErr)
+	}
+	for i, err := range e.Errors {
+		fmt.Fprintf(&b, "; attempt %d: %v", i+1, err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *RetryError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[len(e.Errors)-1]
+}
+
+// Is matches the context's error, so errors.Is(err, context.DeadlineExceeded)
+// works as expected.
+func (e *RetryError) Is(target error) bool {
+	return e.ContextErr != nil && e.ContextErr == target
+}
+
+// RetryContext is like Retry, but stops as soon as ctx is done, including
+// while sleeping between attempts.  If the operation never succeeds, it
+// returns a *RetryError.  isRetryable and onRetry may be nil.
+func RetryContext(ctx context.Context, operation ContextOperation, policy RetryPolicy, isRetryable IsRetryable, onRetry OnRetry) error {
+	return RetryContextWithClock(ctx, operation, policy, isRetryable, onRetry, SystemClock)
+}
+
+// RetryContextWithClock is like RetryContext, but uses clock to sleep.
+func RetryContextWithClock(ctx context.Context, operation ContextOperation, policy RetryPolicy, isRetryable IsRetryable, onRetry OnRetry, clock Clock) error {
+	var errs []error
+	r := NewRetrier(policy, clock)
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return &RetryError{Errors: errs, Reason: ContextDone, ContextErr: err}
+		}
+
+		err := operation(ctx, attempt)
+		if err == nil {
+			RecordSuccess(policy)
+			return nil
+		}
+		errs = append(errs, err)
+
+		if isRetryable != nil && !isRetryable(err) {
+			return &RetryError{Errors: errs, Reason: NotRetryable}
+		}
+		next := r.NextBackOff()
+		if next == done {
+			return &RetryError{Errors: errs, Reason: PolicyExhausted}
+		}
+		if onRetry != nil {
+			onRetry(attempt, err, next)
+		}
+
+		// The context's deadline cuts the sleep short.
+		timer := clock.NewTimer(next)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return &RetryError{Errors: errs, Reason: ContextDone, ContextErr: ctx.Err()}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryContextSuccess(t *testing.T) {
+	policy := NewExponentialRetryPolicy(time.Millisecond)
+	policy.SetMaximumAttempts(10)
+
+	var attempts, retries []int
+	err := RetryContext(context.Background(), func(_ context.Context, attempt int) error {
+		attempts = append(attempts, attempt)
+		if attempt < 3 {
+			return &someError{}
+		}
+		return nil
+	}, policy, nil, func(attempt int, err error, next time.Duration) {
+		assert.Equal(t, &someError{}, err)
+		assert.True(t, next > 0)
+		retries = append(retries, attempt)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+	assert.Equal(t, []int{1, 2}, retries)
+}
+
+func TestRetryContextGivesUp(t *testing.T) {
+	errFatal := errors.New("fatal")
+	for _, tc := range []struct {
+		name        string
+		errs        []error
+		isRetryable IsRetryable
+		reason      StopReason
+	}{
+		{
+			name:   "policy exhausted",
+			errs:   []error{&someError{}, &someError{}, &someError{}},
+			reason: PolicyExhausted,
+		},
+		{
+			name:        "not retryable",
+			errs:        []error{&someError{}, errFatal},
+			isRetryable: IgnoreErrors([]error{errFatal}),
+			reason:      NotRetryable,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := NewExponentialRetryPolicy(time.Millisecond)
+			policy.SetMaximumAttempts(2)
+
+			err := RetryContext(context.Background(), func(_ context.Context, attempt int) error {
+				return tc.errs[attempt-1]
+			}, policy, tc.isRetryable, nil)
+
+			var retryErr *RetryError
+			require.True(t, errors.As(err, &retryErr))
+			assert.Equal(t, tc.reason, retryErr.Reason)
+			assert.Equal(t, tc.errs, retryErr.Errors)
+			assert.Equal(t, tc.errs[len(tc.errs)-1], errors.Unwrap(err))
+		})
+	}
+}
+
+func TestRetryContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	policy := NewExponentialRetryPolicy(time.Second)
+	begin := time.Now()
+	err := RetryContext(ctx, func(context.Context, int) error {
+		return &someError{}
+	}, policy, nil, nil)
+
+	assert.True(t, time.Since(begin) < 500*time.Millisecond, "sleep was not cut short by the deadline")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	var retryErr *RetryError
+	require.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, ContextDone, retryErr.Reason)
+	assert.Len(t, retryErr.Errors, 1)
+}
+
+func TestRetryContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := RetryContext(ctx, func(context.Context, int) error {
+		called = true
+		return nil
+	}, NewExponentialRetryPolicy(time.Millisecond), nil, nil)
+
+	assert.False(t, called)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,408 @@
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type (
+	// RandSource provides the randomness of jittered policies.  A *rand.Rand
+	// with a fixed seed makes them deterministic for tests; policies guard
+	// their source with a mutex, as *rand.Rand is not safe for concurrent
+	// use.
+	RandSource interface {
+		Int63n(n int64) int64
+	}
+
+	// ConstantRetryPolicy always waits the same interval between retries.
+	ConstantRetryPolicy struct {
+		retryLimits
+		interval time.Duration
+	}
+
+	// LinearRetryPolicy waits initialInterval + increment*currentAttempt
+	// between retries.
+	LinearRetryPolicy struct {
+		retryLimits
+		initialInterval time.Duration
+		increment       time.Duration
+	}
+
+	// FullJitterRetryPolicy waits a random interval between 0 and
+	// initialInterval * math.Pow(backoffCoefficient, currentAttempt).
+	FullJitterRetryPolicy struct {
+		retryLimits
+		randomized
+		initialInterval    time.Duration
+		backoffCoefficient float64
+	}
+
+	// EqualJitterRetryPolicy waits half of
+	// initialInterval * math.Pow(backoffCoefficient, currentAttempt), plus a
+	// random interval up to the other half.
+	EqualJitterRetryPolicy struct {
+		retryLimits
+		randomized
+		initialInterval    time.Duration
+		backoffCoefficient float64
+	}
+
+	// DecorrelatedJitterRetryPolicy waits a random interval between
+	// initialInterval and three times the previous interval.
+	DecorrelatedJitterRetryPolicy struct {
+		retryLimits
+		randomized
+		initialInterval time.Duration
+	}
+
+	// RetryPhase is one stage of a ChainedRetryPolicy.
+	RetryPhase struct {
+		Policy RetryPolicy
+		// Attempts is the number of retries Policy is used for.  Only the
+		// last phase may leave it to 0, for no limit.
+		Attempts int
+	}
+
+	// ChainedRetryPolicy uses each phase's policy in turn, moving on to the
+	// next once it has been used for its number of attempts.  Each policy
+	// sees the attempts since the start of its phase, but the total elapsed
+	// time.
+	ChainedRetryPolicy struct {
+		phases []RetryPhase
+	}
+
+	// retryLimits are shared by all the policies of this file.
+	retryLimits struct {
+		maximumInterval    time.Duration
+		expirationInterval time.Duration
+		maximumAttempts    int
+	}
+
+	randomized struct {
+		mtx    sync.Mutex
+		source RandSource
+	}
+
+	globalRand struct{}
+)
+
+// NewConstantRetryPolicy returns an instance of ConstantRetryPolicy.
+func NewConstantRetryPolicy(interval time.Duration) *ConstantRetryPolicy {
+	return &ConstantRetryPolicy{
+		retryLimits: defaultRetryLimits(),
+		interval:    interval,
+	}
+}
+
+// NewLinearRetryPolicy returns an instance of LinearRetryPolicy.
+func NewLinearRetryPolicy(initialInterval, increment time.Duration) *LinearRetryPolicy {
+	return &LinearRetryPolicy{
+		retryLimits:     defaultRetryLimits(),
+		initialInterval: initialInterval,
+		increment:       increment,
+	}
+}
+
+// NewFullJitterRetryPolicy returns an instance of FullJitterRetryPolicy.
+func NewFullJitterRetryPolicy(initialInterval time.Duration) *FullJitterRetryPolicy {
+	return &FullJitterRetryPolicy{
+		retryLimits:        defaultRetryLimits(),
+		initialInterval:    initialInterval,
+		backoffCoefficient: defaultBackoffCoefficient,
+	}
+}
+
+// NewEqualJitterRetryPolicy returns an instance of EqualJitterRetryPolicy.
+func NewEqualJitterRetryPolicy(initialInterval time.Duration) *EqualJitterRetryPolicy {
+	return &EqualJitterRetryPolicy{
+		retryLimits:        defaultRetryLimits(),
+		initialInterval:    initialInterval,
+		backoffCoefficient: defaultBackoffCoefficient,
+	}
+}
+
+// NewDecorrelatedJitterRetryPolicy returns an instance of
+// DecorrelatedJitterRetryPolicy.
+func NewDecorrelatedJitterRetryPolicy(initialInterval time.Duration) *DecorrelatedJitterRetryPolicy {
+	return &DecorrelatedJitterRetryPolicy{
+		retryLimits:     defaultRetryLimits(),
+		initialInterval: initialInterval,
+	}
+}
+
+// NewChainedRetryPolicy creates a ChainedRetryPolicy.
+func NewChainedRetryPolicy(phases ...RetryPhase) *ChainedRetryPolicy {
+	for i := 0; i < len(phases)-1; i++ {
+		if phases[i].Attempts <= 0 {
+			panic("Non final phase in ChainedRetryPolicy need to set attempts")
+		}
+	}
+	return &ChainedRetryPolicy{
+		phases: phases,
+	}
+}
+
+// ComputeNextDelay returns the next delay interval.
+func (p *ConstantRetryPolicy) ComputeNextDelay(elapsedTime time.Duration, numAttempts int) time.Duration {
+	if p.expired(elapsedTime, numAttempts) {
+		return done
+	}
+	return p.capRemaining(elapsedTime, p.capMaximum(p.interval))
+}
+
+// ComputeNextDelay returns the next delay interval.
+func (p *LinearRetryPolicy) ComputeNextDelay(elapsedTime time.Duration, numAttempts int) time.Duration {
+	if p.expired(elapsedTime, numAttempts) {
+		return done
+	}
+	next := float64(p.initialInterval) + float64(p.increment)*float64(numAttempts)
+	if next < 0 {
+		return done
+	}
+	return p.capRemaining(elapsedTime, p.capMaximum(toDuration(next)))
+}
+
+// SetBackoffCoefficient sets the coefficient used to compute the upper bound
+// of the next delay.
+func (p *FullJitterRetryPolicy) SetBackoffCoefficient(backoffCoefficient float64) {
+	p.backoffCoefficient = backoffCoefficient
+}
+
+// ComputeNextDelay returns the next delay interval.
+func (p *FullJitterRetryPolicy) ComputeNextDelay(elapsedTime time.Duration, numAttempts int) time.Duration {
+	if p.expired(elapsedTime, numAttempts) {
+		return done
+	}
+	upper := p.capMaximum(exponentialInterval(p.initialInterval, p.backoffCoefficient, numAttempts))
+	return p.capRemaining(elapsedTime, p.between(0, upper))
+}
+
+// SetBackoffCoefficient sets the coefficient used to compute the upper bound
+// of the next delay.
+func (p *EqualJitterRetryPolicy) SetBackoffCoefficient(backoffCoefficient float64) {
+	p.backoffCoefficient = backoffCoefficient
+}
+
+// ComputeNextDelay returns the next delay interval.
+func (p *EqualJitterRetryPolicy) ComputeNextDelay(elapsedTime time.Duration, numAttempts int) time.Duration {
+	if p.expired(elapsedTime, numAttempts) {
+		return done
+	}
+	upper := p.capMaximum(exponentialInterval(p.initialInterval, p.backoffCoefficient, numAttempts))
+	return p.capRemaining(elapsedTime, p.between(upper/2, upper))
+}
+
+// ComputeNextDelay returns the next delay interval.  Retriers keep the
+// previous interval, but without it the whole sequence of intervals up to
+// numAttempts is drawn again, which gives the same distribution in
+// O(numAttempts).
+func (p *DecorrelatedJitterRetryPolicy) ComputeNextDelay(elapsedTime time.Duration, numAttempts int) time.Duration {
+	if p.expired(elapsedTime, numAttempts) {
+		return done
+	}
+	var previous time.Duration
+	for i := 0; i < numAttempts; i++ {
+		previous = p.draw(i, previous)
+	}
+	return p.capRemaining(elapsedTime, p.draw(numAttempts, previous))
+}
+
+func (p *DecorrelatedJitterRetryPolicy) computeNextDelayFrom(previous, elapsedTime time.Duration, numAttempts int) time.Duration {
+	if p.expired(elapsedTime, numAttempts) {
+		return done
+	}
+	return p.capRemaining(elapsedTime, p.draw(numAttempts, previous))
+}
+
+// draw the interval of attempt numAttempts, following previous.
+func (p *DecorrelatedJitterRetryPolicy) draw(numAttempts int, previous time.Duration) time.Duration {
+	if numAttempts == 0 || previous < p.initialInterval {
+		previous = p.initialInterval
+	}
+	upper := time.Duration(math.MaxInt64)
+	if previous < math.MaxInt64/3 {
+		upper = 3 * previous
+	}
+	return p.capMaximum(p.between(p.initialInterval, upper))
+}
+
+// ComputeNextDelay returns the next delay interval.
+func (p *ChainedRetryPolicy) ComputeNextDelay(elapsedTime time.Duration, numAttempts int) time.Duration {
+	policy, numAttempts := p.phase(numAttempts)
+	if policy == nil {
+		return done
+	}
+	return policy.ComputeNextDelay(elapsedTime, numAttempts)
+}
+
+func (p *ChainedRetryPolicy) computeNextDelayFrom(previous, elapsedTime time.Duration, numAttempts int) time.Duration {
+	policy, numAttempts := p.phase(numAttempts)
+	if policy == nil {
+		return done
+	}
+	return nextDelay(policy, previous, elapsedTime, numAttempts)
+}
+
+// phase returns the policy for numAttempts, and the attempts since the start
+// of its phase, or nil once all phases are over.
+func (p *ChainedRetryPolicy) phase(numAttempts int) (RetryPolicy, int) {
+	for _, phase := range p.phases {
+		if phase.Attempts <= 0 || numAttempts < phase.Attempts {
+			return phase.Policy, numAttempts
+		}
+		numAttempts -= phase.Attempts
+	}
+	return nil, 0
+}
+
+// previousDelayPolicy is implemented by policies whose next delay depends on
+// the previous one.  Retriers keep it for them, as policies are shared.
+type previousDelayPolicy interface {
+	computeNextDelayFrom(previous, elapsedTime time.Duration, numAttempts int) time.Duration
+}
+
+// nextDelay returns the next delay of policy, following previous if it uses
+// it.
+func nextDelay(policy RetryPolicy, previous, elapsedTime time.Duration, numAttempts int) time.Duration {
+	if p, ok := policy.(previousDelayPolicy); ok {
+		return p.computeNextDelayFrom(previous, elapsedTime, numAttempts)
+	}
+	return policy.ComputeNextDelay(elapsedTime, numAttempts)
+}
+
+// MaximumInterval returns the longest delay policy can return, or NoInterval
+// if it has no maximum, or it is not a policy of this package.
+func MaximumInterval(policy RetryPolicy) time.Duration {
+	switch p := policy.(type) {
+	case *ExponentialRetryPolicy:
+		return p.maximumInterval
+	case *MultiPhasesRetryPolicy:
+		policies := make([]RetryPolicy, 0, len(p.policies))
+		for _, phase := range p.policies {
+			policies = append(policies, phase)
+		}
+		return maximumIntervalOf(policies)
+	case *ChainedRetryPolicy:
+		policies := make([]RetryPolicy, 0, len(p.phases))
+		for _, phase := range p.phases {
+			policies = append(policies, phase.Policy)
+		}
+		return maximumIntervalOf(policies)
+	case *budgetedPolicy:
+		return MaximumInterval(p.policy)
+	case interface{ maxInterval() time.Duration }:
+		return p.maxInterval()
+	}
+	return NoInterval
+}
+
+// maximumIntervalOf returns the largest maximum interval of policies, or
+// NoInterval if any has none.
+func maximumIntervalOf(policies []RetryPolicy) time.Duration {
+	max := time.Duration(NoInterval)
+	for _, policy := range policies {
+		interval := MaximumInterval(policy)
+		if interval == NoInterval {
+			return NoInterval
+		}
+		if interval > max {
+			max = interval
+		}
+	}
+	return max
+}
+
+func defaultRetryLimits() retryLimits {
+	return retryLimits{
+		maximumInterval:    defaultMaximumInterval,
+		expirationInterval: defaultExpirationInterval,
+		maximumAttempts:    defaultMaximumAttempts,
+	}
+}
+
+// SetMaximumInterval sets the maximum interval for each retry
+func (l *retryLimits) SetMaximumInterval(maximumInterval time.Duration) {
+	l.maximumInterval = maximumInterval
+}
+
+// SetExpirationInterval sets the absolute expiration interval for all retries
+func (l *retryLimits) SetExpirationInterval(expirationInterval time.Duration) {
+	l.expirationInterval = expirationInterval
+}
+
+// SetMaximumAttempts sets the maximum number of retry attempts
+func (l *retryLimits) SetMaximumAttempts(maximumAttempts int) {
+	l.maximumAttempts = maximumAttempts
+}
+
+func (l *retryLimits) maxInterval() time.Duration {
+	return l.maximumInterval
+}
+
+func (l *retryLimits) expired(elapsedTime time.Duration, numAttempts int) bool {
+	if l.maximumAttempts != noMaximumAttempts && numAttempts >= l.maximumAttempts {
+		return true
+	}
+	return l.expirationInterval != NoInterval && elapsedTime > l.expirationInterval
+}
+
+func (l *retryLimits) capMaximum(next time.Duration) time.Duration {
+	if l.maximumInterval != NoInterval && next > l.maximumInterval {
+		return l.maximumInterval
+	}
+	return next
+}
+
+func (l *retryLimits) capRemaining(elapsedTime, next time.Duration) time.Duration {
+	if l.expirationInterval == NoInterval {
+		return next
+	}
+	if remaining := l.expirationInterval - elapsedTime; remaining <= 0 {
+		return done
+	} else if next > remaining {
+		return remaining
+	}
+	return next
+}
+
+// SetRandSource sets the source of randomness for the jitter.
+func (r *randomized) SetRandSource(source RandSource) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.source = source
+}
+
+func (r *randomized) int63n(n int64) int64 {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.source == nil {
+		return globalRand{}.Int63n(n)
+	}
+	return r.source.Int63n(n)
+}
+
+// between returns a random duration in [min, max).
+func (r *randomized) between(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(r.int63n(int64(max-min)))
+}
+
+func (globalRand) Int63n(n int64) int64 {
+	return rand.Int63n(n)
+}
+
+func exponentialInterval(initialInterval time.Duration, backoffCoefficient float64, numAttempts int) time.Duration {
+	return toDuration(float64(initialInterval) * math.Pow(backoffCoefficient, float64(numAttempts)))
+}
+
+// toDuration converts d, saturating instead of overflowing.
+func toDuration(d float64) time.Duration {
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
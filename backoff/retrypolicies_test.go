@@ -0,0 +1,149 @@
+package backoff
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedRand always returns the same fraction of n.
+type fixedRand float64
+
+func (f fixedRand) Int63n(n int64) int64 {
+	return int64(float64(n-1) * float64(f))
+}
+
+func nextBackOffs(policy RetryPolicy, n int) []time.Duration {
+	r, clock := createRetrier(policy)
+	var result []time.Duration
+	for i := 0; i < n; i++ {
+		next := r.NextBackOff()
+		result = append(result, next)
+		if next == done {
+			break
+		}
+		clock.Advance(next)
+	}
+	return result
+}
+
+func TestConstantRetryPolicy(t *testing.T) {
+	policy := NewConstantRetryPolicy(time.Second)
+	policy.SetMaximumAttempts(3)
+	assert.Equal(t, []time.Duration{time.Second, time.Second, time.Second, done}, nextBackOffs(policy, 10))
+}
+
+func TestLinearRetryPolicy(t *testing.T) {
+	policy := NewLinearRetryPolicy(time.Second, 2*time.Second)
+	policy.SetMaximumInterval(6 * time.Second)
+	policy.SetExpirationInterval(20 * time.Second)
+	assert.Equal(t, []time.Duration{
+		time.Second, 3 * time.Second, 5 * time.Second, 6 * time.Second,
+		5 * time.Second, // Clamped to the expiration interval.
+		done,
+	}, nextBackOffs(policy, 10))
+}
+
+func TestFullJitterRetryPolicy(t *testing.T) {
+	policy := NewFullJitterRetryPolicy(time.Second)
+	policy.SetMaximumInterval(4 * time.Second)
+	policy.SetMaximumAttempts(4)
+
+	policy.SetRandSource(fixedRand(0))
+	assert.Equal(t, []time.Duration{0, 0, 0, 0, done}, nextBackOffs(policy, 10))
+
+	policy.SetRandSource(fixedRand(1))
+	assert.Equal(t, []time.Duration{
+		time.Second - 1, 2*time.Second - 1, 4*time.Second - 1, 4*time.Second - 1, done,
+	}, nextBackOffs(policy, 10))
+}
+
+func TestEqualJitterRetryPolicy(t *testing.T) {
+	policy := NewEqualJitterRetryPolicy(time.Second)
+	policy.SetBackoffCoefficient(3)
+	policy.SetMaximumAttempts(3)
+
+	policy.SetRandSource(fixedRand(0))
+	assert.Equal(t, []time.Duration{
+		500 * time.Millisecond, 1500 * time.Millisecond, 4500 * time.Millisecond, done,
+	}, nextBackOffs(policy, 10))
+}
+
+func TestDecorrelatedJitterRetryPolicy(t *testing.T) {
+	policy := NewDecorrelatedJitterRetryPolicy(time.Second)
+	policy.SetMaximumInterval(time.Minute)
+	policy.SetExpirationInterval(NoInterval)
+	policy.SetMaximumAttempts(5)
+
+	// Always just under three times the previous interval.
+	policy.SetRandSource(fixedRand(1))
+	assert.Equal(t, []time.Duration{
+		3*time.Second - 1, 9*time.Second - 4, 27*time.Second - 13, time.Minute, time.Minute, done,
+	}, nextBackOffs(policy, 10))
+
+	// Without a Retrier keeping the previous interval, the sequence is drawn
+	// again.
+	assert.Equal(t, 27*time.Second-13, policy.ComputeNextDelay(0, 2))
+
+	policy.SetRandSource(rand.New(rand.NewSource(0)))
+	for _, next := range nextBackOffs(policy, 5) {
+		assert.True(t, next >= time.Second && next <= time.Minute, "unexpected interval %v", next)
+	}
+
+	// The source is shared by concurrent retriers.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nextBackOffs(policy, 5)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestChainedRetryPolicy(t *testing.T) {
+	fast := NewConstantRetryPolicy(10 * time.Millisecond)
+	slow := NewLinearRetryPolicy(time.Second, time.Second)
+	slow.SetMaximumAttempts(2)
+	policy := NewChainedRetryPolicy(RetryPhase{Policy: fast, Attempts: 2}, RetryPhase{Policy: slow})
+
+	assert.Equal(t, []time.Duration{
+		10 * time.Millisecond, 10 * time.Millisecond, time.Second, 2 * time.Second, done,
+	}, nextBackOffs(policy, 10))
+
+	assert.Panics(t, func() {
+		NewChainedRetryPolicy(RetryPhase{Policy: fast}, RetryPhase{Policy: slow})
+	})
+}
+
+func TestExponentialRetryPolicyRandSource(t *testing.T) {
+	policy := createPolicy(time.Second)
+	policy.SetMaximumAttempts(3)
+	policy.SetRandSource(fixedRand(0))
+	assert.Equal(t, []time.Duration{
+		800 * time.Millisecond, 1600 * time.Millisecond, 3200 * time.Millisecond, done,
+	}, nextBackOffs(policy, 10))
+}
+
+func TestMaximumInterval(t *testing.T) {
+	constant := NewConstantRetryPolicy(time.Second)
+	constant.SetMaximumInterval(5 * time.Second)
+	exponential := NewExponentialRetryPolicy(time.Second)
+	exponential.SetMaximumInterval(20 * time.Second)
+	unbounded := NewLinearRetryPolicy(time.Second, time.Second)
+	unbounded.SetMaximumInterval(NoInterval)
+
+	assert.Equal(t, 5*time.Second, MaximumInterval(constant))
+	assert.Equal(t, 20*time.Second, MaximumInterval(exponential))
+	assert.Equal(t, 20*time.Second, MaximumInterval(NewChainedRetryPolicy(
+		RetryPhase{Policy: constant, Attempts: 1}, RetryPhase{Policy: exponential})))
+	assert.Equal(t, time.Duration(NoInterval), MaximumInterval(NewChainedRetryPolicy(
+		RetryPhase{Policy: constant, Attempts: 1}, RetryPhase{Policy: unbounded})))
+	assert.Equal(t, 5*time.Second, MaximumInterval(NewRetryBudget("test", RetryBudgetConfig{}, prometheus.NewRegistry()).Policy(constant)))
+	assert.Equal(t, time.Duration(NoInterval), MaximumInterval(unbounded))
+}
@@ -22,7 +22,6 @@ package backoff
 
 import (
 	"math"
-	"math/rand"
 	"time"
 )
 
@@ -36,6 +35,10 @@ const (
 	defaultMaximumInterval    = 10 * time.Second
 	defaultExpirationInterval = time.Minute
 	defaultMaximumAttempts    = noMaximumAttempts
+
+	// Done is returned by RetryPolicy and Retrier when no more retries are
+	// allowed.
+	Done = done
 )
 
 type (
@@ -50,14 +53,20 @@ type (
 		Reset()
 	}
 
-	// Clock used by ExponentialRetryPolicy implementation to get the current time.  Mainly used for unit testing
+	// Clock is used by this package to get the current time and to wait.
+	// Tests can use a FakeClock instead of SystemClock to control time.
 	Clock interface {
 		Now() time.Time
+		Sleep(d time.Duration)
+		After(d time.Duration) <-chan time.Time
+		NewTimer(d time.Duration) Timer
+		NewTicker(d time.Duration) Ticker
 	}
 
 	// ExponentialRetryPolicy provides the implementation for retry policy using a coefficient to compute the next delay.
 	// Formula used to compute the next delay is: initialInterval * math.Pow(backoffCoefficient, currentAttempt)
 	ExponentialRetryPolicy struct {
+		randomized
 		initialInterval    time.Duration
 		backoffCoefficient float64
 		maximumInterval    time.Duration
@@ -68,7 +77,7 @@ type (
 	// MultiPhasesRetryPolicy implements a policy that first use one policy to get next delay,
 	// and once expired use the next policy for the following retry.
 	// It can achieve fast retries in first phase then slowly retires in second phase.
-	// The supported retry policy is ExponentialRetryPolicy.
+	// The supported retry policy is ExponentialRetryPolicy; use ChainedRetryPolicy for others.
 	// To have the correct next delay, set the maximumAttempts in the non-final policy.
 	MultiPhasesRetryPolicy struct {
 		policies []*ExponentialRetryPolicy
@@ -81,10 +90,12 @@ type (
 		clock          Clock
 		currentAttempt int
 		startTime      time.Time
+		// previous delay, for previousDelayPolicy.
+		previous time.Duration
 	}
 )
 
-// SystemClock implements Clock interface that uses time.Now().
+// SystemClock implements Clock interface using the time package.
 var SystemClock = systemClock{}
 
 // NewExponentialRetryPolicy returns an instance of ExponentialRetryPolicy using the provided initialInterval
@@ -197,7 +208,7 @@ func (p *ExponentialRetryPolicy) ComputeNextDelay(elapsedTime time.Duration, num
 	if jitterPortion < 1 {
 		jitterPortion = 1
 	}
-	nextInterval = nextInterval*0.8 + float64(rand.Intn(jitterPortion))
+	nextInterval = nextInterval*0.8 + float64(p.int63n(int64(jitterPortion)))
 
 	return time.Duration(nextInterval)
 }
@@ -224,11 +235,13 @@ func (t systemClock) Now() time.Time {
 func (r *retrierImpl) Reset() {
 	r.startTime = r.clock.Now()
 	r.currentAttempt = 0
+	r.previous = 0
 }
 
 // NextBackOff returns the next delay interval.  This is used by Retry to delay calling the operation again
 func (r *retrierImpl) NextBackOff() time.Duration {
-	nextInterval := r.policy.ComputeNextDelay(r.getElapsedTime(), r.currentAttempt)
+	nextInterval := nextDelay(r.policy, r.previous, r.getElapsedTime(), r.currentAttempt)
+	r.previous = nextInterval
 
 	// Now increment the current attempt
 	r.currentAttempt++
@@ -33,10 +33,6 @@ type (
 		*require.Assertions // override suite.Suite.Assertions with require.Assertions; this means that s.NotNil(nil) will stop the test, not merely log an error
 		suite.Suite
 	}
-
-	TestClock struct {
-		currentTime time.Time
-	}
 )
 
 func TestRetryPolicySuite(t *testing.T) {
@@ -115,7 +111,7 @@ func (s *RetryPolicySuite) TestExpirationInterval() {
 	policy.SetExpirationInterval(5 * time.Minute)
 
 	r, clock := createRetrier(policy)
-	clock.moveClock(6 * time.Minute)
+	clock.Advance(6 * time.Minute)
 	next := r.NextBackOff()
 
 	s.Equal(done, next)
@@ -131,7 +127,7 @@ func (s *RetryPolicySuite) TestExpirationOverflow() {
 	s.True(next >= min, "NextBackoff too low")
 	s.True(next < max, "NextBackoff too high")
 
-	clock.moveClock(2 * time.Second)
+	clock.Advance(2 * time.Second)
 
 	next = r.NextBackOff()
 	min, max = getNextBackoffRange(3 * time.Second)
@@ -171,7 +167,7 @@ func (s *RetryPolicySuite) TestDefaultPublishRetryPolicy() {
 			min, _ := getNextBackoffRange(expected)
 			s.True(next >= min, "NextBackoff too low: actual: %v, expected: %v", next, expected)
 			// s.True(next < max, "NextBackoff too high: actual: %v, expected: %v", next, expected)
-			clock.moveClock(expected)
+			clock.Advance(expected)
 		}
 	}
 }
@@ -186,7 +182,7 @@ func (s *RetryPolicySuite) TestNoMaxAttempts() {
 		next := r.NextBackOff()
 		//print("Iter: ", i, ", Next Backoff: ", next.String(), "\n")
 		s.True(next > 0 || next == done, "Unexpected value for next retry duration: %v", next)
-		clock.moveClock(next)
+		clock.Advance(next)
 	}
 }
 
@@ -198,7 +194,7 @@ func (s *RetryPolicySuite) TestUnbounded() {
 		next := r.NextBackOff()
 		//print("Iter: ", i, ", Next Backoff: ", next.String(), "\n")
 		s.True(next > 0 || next == done, "Unexpected value for next retry duration: %v", next)
-		clock.moveClock(next)
+		clock.Advance(next)
 	}
 }
 
@@ -233,19 +229,11 @@ func (s *RetryPolicySuite) TestMultiPhasesRetryPolicy() {
 			min, max := getNextBackoffRange(expected)
 			s.True(next >= min, "NextBackoff too low: actual: %v, expected: %v", next, expected)
 			s.True(next < max, "NextBackoff too high: actual: %v, expected: %v", next, expected)
-			clock.moveClock(expected)
+			clock.Advance(expected)
 		}
 	}
 }
 
-func (c *TestClock) Now() time.Time {
-	return c.currentTime
-}
-
-func (c *TestClock) moveClock(duration time.Duration) {
-	c.currentTime = c.currentTime.Add(duration)
-}
-
 func createPolicy(initialInterval time.Duration) *ExponentialRetryPolicy {
 	policy := NewExponentialRetryPolicy(initialInterval)
 	policy.SetBackoffCoefficient(2)
@@ -256,8 +244,8 @@ func createPolicy(initialInterval time.Duration) *ExponentialRetryPolicy {
 	return policy
 }
 
-func createRetrier(policy RetryPolicy) (Retrier, *TestClock) {
-	clock := &TestClock{currentTime: time.Time{}}
+func createRetrier(policy RetryPolicy) (Retrier, *FakeClock) {
+	clock := NewFakeClock(time.Time{})
 	return NewRetrier(policy, clock), clock
 }
 
@@ -0,0 +1,238 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/videocoin/common/instrument"
+	"github.com/videocoin/common/logging"
+)
+
+// OverlapPolicy decides what happens when a job is due while its previous run
+// is still going.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the new run.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue starts the new run once the previous one is done.  Runs
+	// due in the meantime are coalesced into one.
+	OverlapQueue
+	// OverlapReplace cancels the previous run, and starts the new one once
+	// the previous one has returned.
+	OverlapReplace
+)
+
+// Job is run by a Scheduler.
+type Job struct {
+	// Name is the operation label of the job's metrics.
+	Name string
+	// Schedule is a cron expression, as accepted by ParseSchedule.
+	Schedule string
+	Run      func(ctx context.Context) error
+	Overlap  OverlapPolicy
+	// Timeout cancels the context of runs which take longer, if positive.
+	Timeout time.Duration
+	// Jitter delays each run by a random duration up to Jitter, so that
+	// replicas do not all run at once.  It should be shorter than the
+	// interval between runs.
+	Jitter time.Duration
+}
+
+// Scheduler runs Jobs on their cron schedules, recording every run with a
+// Collector, typically an instrument.JobCollector.
+type Scheduler struct {
+	collector instrument.Collector
+	log       logging.Interface
+	clock     Clock
+
+	mtx     sync.Mutex
+	jobs    map[string]*scheduledJob
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+	wg      sync.WaitGroup
+}
+
+type scheduledJob struct {
+	Job
+	schedule cron.Schedule
+
+	mtx     sync.Mutex
+	running chan struct{} // Closed when the current run returns, nil if none.
+	cancel  context.CancelFunc
+	queued  bool
+}
+
+// NewScheduler makes a new Scheduler.
+func NewScheduler(collector instrument.Collector, log logging.Interface) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		collector: collector,
+		log:       logging.Named(log, "backoff"),
+		clock:     SystemClock,
+		jobs:      map[string]*scheduledJob{},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// SetClock sets the clock used to wait for runs.  Call it before Start.
+func (s *Scheduler) SetClock(c Clock) {
+	s.clock = c
+}
+
+// Add a job.  If the Scheduler is already started, the job is scheduled right
+// away.
+func (s *Scheduler) Add(job Job) error {
+	if job.Run == nil {
+		return fmt.Errorf("job %q has no Run function", job.Name)
+	}
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for job %q: %v", job.Name, err)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("duplicate job %q", job.Name)
+	}
+	j := &scheduledJob{Job: job, schedule: schedule}
+	s.jobs[job.Name] = j
+	if s.started {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+	return nil
+}
+
+// Start scheduling jobs.
+func (s *Scheduler) Start() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+}
+
+// Stop scheduling jobs, cancel the running ones, and wait for them to return.
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(j *scheduledJob) {
+	defer s.wg.Done()
+	for {
+		now := s.clock.Now()
+		next := j.schedule.Next(now)
+		if next.IsZero() {
+			s.log.WithField("job", j.Name).Warnln("Job will not run again, its schedule has no upcoming fire time")
+			return
+		}
+		delay := next.Sub(now)
+		if j.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(j.Jitter)))
+		}
+
+		timer := s.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+		s.trigger(j)
+	}
+}
+
+func (s *Scheduler) trigger(j *scheduledJob) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if j.running == nil {
+		s.start(j, nil)
+		return
+	}
+	switch j.Overlap {
+	case OverlapSkip:
+		s.log.WithField("job", j.Name).Warnln("Skipping run, as the previous one is still running")
+	case OverlapQueue:
+		j.queued = true
+	case OverlapReplace:
+		j.cancel()
+		s.start(j, j.running)
+	}
+}
+
+// start a run once previous has returned, if not nil.  j.mtx must be held.
+func (s *Scheduler) start(j *scheduledJob, previous chan struct{}) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if j.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(s.ctx, j.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(s.ctx)
+	}
+	done := make(chan struct{})
+	j.running, j.cancel, j.queued = done, cancel, false
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if previous != nil {
+			<-previous
+		}
+
+		err := func() error {
+			defer cancel()
+			return instrument.CollectedRequest(ctx, j.Name, s.collector, runStatus, j.Run)
+		}()
+		if err != nil {
+			s.log.WithFields(logging.Fields{"job": j.Name, "err": err}).Warnln("Job failed")
+		}
+		close(done)
+
+		j.mtx.Lock()
+		defer j.mtx.Unlock()
+		if j.running != done {
+			// Replaced already.
+			return
+		}
+		j.running, j.cancel = nil, nil
+		if j.queued {
+			s.start(j, nil)
+		}
+	}()
+}
+
+// runStatus is the status_code label of a run.
+func runStatus(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,213 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/videocoin/common/logging"
+)
+
+type run struct {
+	job, status string
+}
+
+type fakeCollector struct {
+	mtx  sync.Mutex
+	runs []run
+}
+
+func (c *fakeCollector) Register() {}
+
+func (c *fakeCollector) Before(ctx context.Context, method string, start time.Time) {}
+
+func (c *fakeCollector) After(ctx context.Context, method, statusCode string, start time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.runs = append(c.runs, run{method, statusCode})
+}
+
+func (c *fakeCollector) recorded() []run {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]run(nil), c.runs...)
+}
+
+func newTestScheduler() (*Scheduler, *fakeCollector, *FakeClock) {
+	collector := &fakeCollector{}
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewScheduler(collector, logging.Noop())
+	s.SetClock(clock)
+	return s, collector, clock
+}
+
+// tick advances the clock to the next minute once the scheduler waits on it,
+// and waits for the scheduler to have triggered the job.
+func tick(clock *FakeClock) {
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	s, collector, clock := newTestScheduler()
+	runs := make(chan struct{}, 10)
+	require.NoError(t, s.Add(Job{
+		Name:     "ok",
+		Schedule: "* * * * *",
+		Run: func(ctx context.Context) error {
+			runs <- struct{}{}
+			return nil
+		},
+	}))
+	s.Start()
+
+	for i := 0; i < 3; i++ {
+		tick(clock)
+		<-runs
+	}
+	s.Stop()
+
+	assert.Equal(t, []run{{"ok", "success"}, {"ok", "success"}, {"ok", "success"}}, collector.recorded())
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	s, _, _ := newTestScheduler()
+	run := func(context.Context) error { return nil }
+
+	assert.NoError(t, s.Add(Job{Name: "a", Schedule: "@hourly", Run: run}))
+	assert.Error(t, s.Add(Job{Name: "a", Schedule: "@hourly", Run: run}))
+	assert.Error(t, s.Add(Job{Name: "b", Schedule: "not a schedule", Run: run}))
+	assert.Error(t, s.Add(Job{Name: "c", Schedule: "@hourly"}))
+}
+
+func TestSchedulerOverlapSkip(t *testing.T) {
+	s, collector, clock := newTestScheduler()
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	require.NoError(t, s.Add(Job{
+		Name:     "skip",
+		Schedule: "* * * * *",
+		Overlap:  OverlapSkip,
+		Run: func(ctx context.Context) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		},
+	}))
+	s.Start()
+
+	tick(clock)
+	<-started
+	tick(clock)
+	tick(clock)
+	close(release)
+	s.Stop()
+
+	assert.Len(t, started, 0)
+	assert.Equal(t, []run{{"skip", "success"}}, collector.recorded())
+}
+
+func TestSchedulerOverlapQueue(t *testing.T) {
+	s, collector, clock := newTestScheduler()
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	require.NoError(t, s.Add(Job{
+		Name:     "queue",
+		Schedule: "* * * * *",
+		Overlap:  OverlapQueue,
+		Run: func(ctx context.Context) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		},
+	}))
+	s.Start()
+
+	tick(clock)
+	<-started
+	// Both runs due while the first one is going are coalesced into one.
+	tick(clock)
+	tick(clock)
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+	close(release)
+	s.Stop()
+
+	assert.Len(t, started, 0)
+	assert.Equal(t, []run{{"queue", "success"}, {"queue", "success"}}, collector.recorded())
+}
+
+func TestSchedulerOverlapReplace(t *testing.T) {
+	s, collector, clock := newTestScheduler()
+	started := make(chan struct{}, 10)
+	require.NoError(t, s.Add(Job{
+		Name:     "replace",
+		Schedule: "* * * * *",
+		Overlap:  OverlapReplace,
+		Run: func(ctx context.Context) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	s.Start()
+
+	tick(clock)
+	<-started
+	tick(clock)
+	<-started
+	s.Stop()
+
+	assert.Equal(t, []run{{"replace", "cancelled"}, {"replace", "cancelled"}}, collector.recorded())
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	s, collector, clock := newTestScheduler()
+	done := make(chan struct{})
+	require.NoError(t, s.Add(Job{
+		Name:     "slow",
+		Schedule: "* * * * *",
+		Timeout:  10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			defer close(done)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	s.Start()
+
+	tick(clock)
+	<-done
+	s.Stop()
+
+	assert.Equal(t, []run{{"slow", "timeout"}}, collector.recorded())
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	s, collector, clock := newTestScheduler()
+	runs := make(chan struct{}, 1)
+	require.NoError(t, s.Add(Job{
+		Name:     "jittered",
+		Schedule: "* * * * *",
+		Jitter:   30 * time.Second,
+		Run: func(ctx context.Context) error {
+			runs <- struct{}{}
+			return errors.New("failed")
+		},
+	}))
+	s.Start()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute + 30*time.Second)
+	<-runs
+	s.Stop()
+
+	assert.Equal(t, []run{{"jittered", "error"}}, collector.recorded())
+}
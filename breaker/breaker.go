@@ -0,0 +1,256 @@
+package breaker
+
+import (
+	"errors"
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/videocoin/common/mtime"
+)
+
+// State of a Breaker.
+type State int
+
+// The states a Breaker can be in.
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrOpen is returned instead of making a request while the breaker is open.
+// Its gRPC status code is Unavailable.
+var ErrOpen error = openError{}
+
+type openError struct{}
+
+func (openError) Error() string {
+	return openError{}.GRPCStatus().Err().Error()
+}
+
+// GRPCStatus implements the interface status.FromError looks for.
+func (openError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, "circuit breaker is open")
+}
+
+// IsOpen returns true if err was returned because a breaker is open, even if
+// it was wrapped since.
+func IsOpen(err error) bool {
+	return errors.Is(err, ErrOpen)
+}
+
+// The defaults of Config, used for fields left unset.
+const (
+	DefaultFailureRatio     = 0.5
+	DefaultMinRequests      = 20
+	DefaultWindow           = 10 * time.Second
+	DefaultCoolDown         = 5 * time.Second
+	DefaultHalfOpenRequests = 1
+)
+
+// Config for a Breaker.  Fields left to 0 take their default.
+type Config struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureRatio     float64       `yaml:"failure_ratio"`
+	MinRequests      int           `yaml:"min_requests"`
+	Window           time.Duration `yaml:"window"`
+	CoolDown         time.Duration `yaml:"cool_down"`
+	HalfOpenRequests int           `yaml:"half_open_requests"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, prefix+"circuit-breaker.enabled", false, "Stop sending requests to a target while too many of them fail.")
+	f.Float64Var(&cfg.FailureRatio, prefix+"circuit-breaker.failure-ratio", DefaultFailureRatio, "Ratio of failed requests within the window above which the breaker opens.")
+	f.IntVar(&cfg.MinRequests, prefix+"circuit-breaker.min-requests", DefaultMinRequests, "Minimum number of requests within the window before the breaker can open.")
+	f.DurationVar(&cfg.Window, prefix+"circuit-breaker.window", DefaultWindow, "Window over which request failures are counted.")
+	f.DurationVar(&cfg.CoolDown, prefix+"circuit-breaker.cool-down", DefaultCoolDown, "How long the breaker stays open before letting probe requests through.")
+	f.IntVar(&cfg.HalfOpenRequests, prefix+"circuit-breaker.half-open-requests", DefaultHalfOpenRequests, "Number of successful probe requests needed to close the breaker again.")
+}
+
+// Breaker is a circuit breaker.  While closed, it lets requests through and
+// counts failures.  Once the failure ratio is exceeded it opens, and fails
+// requests straight away for the cool-down.  It then goes half-open, and
+// lets a few probe requests through: if they succeed it closes, otherwise
+// it opens again.
+type Breaker struct {
+	cfg   Config
+	gauge prometheus.Gauge
+
+	mtx        sync.Mutex
+	state      State
+	generation uint64
+	expiry     time.Time // end of the current window or cool-down
+	requests   int
+	failures   int
+	successes  int // probes, when half-open
+	inflight   int // probes, when half-open
+}
+
+// New makes a new Breaker.  If gauge is not nil it is kept set to the
+// current State.
+func New(cfg Config, gauge prometheus.Gauge) *Breaker {
+	if cfg.FailureRatio <= 0 {
+		cfg.FailureRatio = DefaultFailureRatio
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = DefaultMinRequests
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = DefaultCoolDown
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = DefaultHalfOpenRequests
+	}
+	b := &Breaker{
+		cfg:   cfg,
+		gauge: gauge,
+	}
+	b.setState(Closed, mtime.Now())
+	return b
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.currentState(mtime.Now())
+}
+
+// Allow checks whether a request may go through.  If so, the returned
+// function must be called with the outcome of the request; otherwise
+// ErrOpen is returned.
+func (b *Breaker) Allow() (func(success bool), error) {
+	generation, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	return func(success bool) {
+		b.done(generation, success)
+	}, nil
+}
+
+// allow is Allow, returning the generation to pass to done or ignore.
+func (b *Breaker) allow() (uint64, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := mtime.Now()
+	switch b.currentState(now) {
+	case Open:
+		return 0, ErrOpen
+	case HalfOpen:
+		if b.inflight >= b.cfg.HalfOpenRequests {
+			return 0, ErrOpen
+		}
+		b.inflight++
+	}
+	b.requests++
+	return b.generation, nil
+}
+
+// ignore a request allowed in generation, as if it had not been made.
+func (b *Breaker) ignore(generation uint64) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	state := b.currentState(mtime.Now())
+	if generation != b.generation {
+		return
+	}
+	b.requests--
+	if state == HalfOpen {
+		b.inflight--
+	}
+}
+
+func (b *Breaker) done(generation uint64, success bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := mtime.Now()
+	state := b.currentState(now)
+	// Ignore results of requests started in a previous state.
+	if generation != b.generation {
+		return
+	}
+
+	switch state {
+	case Closed:
+		if success {
+			return
+		}
+		b.failures++
+		if b.requests >= b.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= b.cfg.FailureRatio {
+			b.setState(Open, now)
+		}
+	case HalfOpen:
+		b.inflight--
+		if !success {
+			b.setState(Open, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.setState(Closed, now)
+		}
+	}
+}
+
+// currentState moves on to the next state or window if the current one has
+// expired.  Must be called with mtx held.
+func (b *Breaker) currentState(now time.Time) State {
+	switch b.state {
+	case Closed:
+		if b.cfg.Window > 0 && now.After(b.expiry) {
+			b.setState(Closed, now)
+		}
+	case Open:
+		if now.After(b.expiry) {
+			b.setState(HalfOpen, now)
+		}
+	}
+	return b.state
+}
+
+// setState resets the counts for a new state or window.  Must be called
+// with mtx held.
+func (b *Breaker) setState(state State, now time.Time) {
+	b.state = state
+	b.generation++
+	b.requests, b.failures, b.successes, b.inflight = 0, 0, 0, 0
+
+	switch state {
+	case Closed:
+		b.expiry = now.Add(b.cfg.Window)
+	case Open:
+		b.expiry = now.Add(b.cfg.CoolDown)
+	default:
+		b.expiry = time.Time{}
+	}
+
+	if b.gauge != nil {
+		b.gauge.Set(float64(state))
+	}
+}
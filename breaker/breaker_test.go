@@ -0,0 +1,203 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/videocoin/common/mtime"
+)
+
+var testConfig = Config{
+	Enabled:          true,
+	FailureRatio:     0.5,
+	MinRequests:      4,
+	Window:           10 * time.Second,
+	CoolDown:         5 * time.Second,
+	HalfOpenRequests: 2,
+}
+
+func request(t *testing.T, b *Breaker, success bool) {
+	done, err := b.Allow()
+	require.NoError(t, err)
+	done(success)
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "state"})
+	b := New(testConfig, gauge)
+
+	// Not enough requests to open yet.
+	request(t, b, false)
+	request(t, b, false)
+	request(t, b, true)
+	assert.Equal(t, Closed, b.State())
+
+	request(t, b, false)
+	assert.Equal(t, Open, b.State())
+	assert.Equal(t, float64(Open), testutil.ToFloat64(gauge))
+
+	_, err := b.Allow()
+	assert.True(t, IsOpen(err))
+
+	// After the cool-down, only HalfOpenRequests probes are let through.
+	mtime.NowForce(now.Add(6 * time.Second))
+	assert.Equal(t, HalfOpen, b.State())
+	done1, err := b.Allow()
+	require.NoError(t, err)
+	done2, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	assert.Equal(t, ErrOpen, err)
+
+	done1(true)
+	assert.Equal(t, HalfOpen, b.State())
+	done2(true)
+	assert.Equal(t, Closed, b.State())
+	assert.Equal(t, float64(Closed), testutil.ToFloat64(gauge))
+}
+
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	b := New(testConfig, nil)
+	for i := 0; i < 4; i++ {
+		request(t, b, false)
+	}
+	assert.Equal(t, Open, b.State())
+
+	mtime.NowForce(now.Add(6 * time.Second))
+	request(t, b, false)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerWindow(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	b := New(testConfig, nil)
+	for i := 0; i < 3; i++ {
+		request(t, b, false)
+	}
+
+	// Failures from the previous window are forgotten.
+	mtime.NowForce(now.Add(11 * time.Second))
+	request(t, b, false)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	b := New(Config{FailureRatio: 0.5, MinRequests: 2, CoolDown: time.Minute}, nil)
+	interceptor := UnaryClientInterceptor(b, nil)
+
+	calls := 0
+	invoker := func(err error) grpc.UnaryInvoker {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			return err
+		}
+	}
+
+	// Client errors don't count against the target.
+	err := interceptor(context.Background(), "/foo", nil, nil, nil, invoker(status.Error(codes.InvalidArgument, "bad")))
+	assert.Error(t, err)
+	assert.Equal(t, Closed, b.State())
+
+	err = interceptor(context.Background(), "/foo", nil, nil, nil, invoker(status.Error(codes.Unavailable, "down")))
+	assert.Error(t, err)
+	assert.Equal(t, Open, b.State())
+
+	err = interceptor(context.Background(), "/foo", nil, nil, nil, invoker(errors.New("not called")))
+	assert.True(t, IsOpen(err))
+	assert.Equal(t, 2, calls)
+}
+
+func TestInterceptorIgnoresDoneContext(t *testing.T) {
+	b := New(Config{FailureRatio: 0.5, MinRequests: 1, CoolDown: time.Minute, HalfOpenRequests: 1}, nil)
+	interceptor := UnaryClientInterceptor(b, nil)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		<-ctx.Done()
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	// The caller's own deadline is not the target's fault.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err := interceptor(ctx, "/foo", nil, nil, nil, invoker)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, Closed, b.State())
+
+	// Nor is cancelling a probe, which lets another one through.
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+	request(t, b, false)
+	mtime.NowForce(now.Add(time.Minute + time.Second))
+	require.Equal(t, HalfOpen, b.State())
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = interceptor(ctx, "/foo", nil, nil, nil, invoker)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.Equal(t, HalfOpen, b.State())
+	request(t, b, true)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestConfigDefaults(t *testing.T) {
+	b := New(Config{}, nil)
+	for i := 0; i < DefaultMinRequests-1; i++ {
+		request(t, b, false)
+	}
+	assert.Equal(t, Closed, b.State())
+	request(t, b, false)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestIsOpen(t *testing.T) {
+	assert.True(t, IsOpen(ErrOpen))
+	assert.True(t, IsOpen(fmt.Errorf("calling target: %w", ErrOpen)))
+	assert.Equal(t, codes.Unavailable, status.Code(ErrOpen))
+
+	// Errors from the target are not mistaken for an open breaker, even with
+	// the same text.
+	assert.False(t, IsOpen(status.Error(codes.Unavailable, "circuit breaker is open")))
+	assert.False(t, IsOpen(nil))
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	b := New(Config{FailureRatio: 0.5, MinRequests: 1, CoolDown: time.Minute}, nil)
+	interceptor := StreamClientInterceptor(b, nil)
+
+	calls := 0
+	streamer := func(err error) grpc.Streamer {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			calls++
+			return nil, err
+		}
+	}
+
+	_, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/foo", streamer(status.Error(codes.Unavailable, "down")))
+	assert.Error(t, err)
+	assert.Equal(t, Open, b.State())
+
+	_, err = interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/foo", streamer(nil))
+	assert.True(t, IsOpen(err))
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,71 @@
+package breaker
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IsFailure decides whether an error returned by a request should count
+// against the breaker.
+type IsFailure func(error) bool
+
+// IsServerFailure counts errors which suggest the target is unhealthy, as
+// opposed to errors caused by the request itself.  The interceptors ignore
+// errors of requests whose context is done, so DeadlineExceeded only counts
+// when it comes from the target.
+func IsServerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unknown, codes.DeadlineExceeded, codes.ResourceExhausted,
+		codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// UnaryClientInterceptor fails requests fast while the breaker is open.
+// Requests whose context is done by the time they return are not counted, as
+// the caller gave up on them.  If isFailure is nil, IsServerFailure is used.
+func UnaryClientInterceptor(b *Breaker, isFailure IsFailure) grpc.UnaryClientInterceptor {
+	if isFailure == nil {
+		isFailure = IsServerFailure
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		generation, err := b.allow()
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		b.outcome(ctx, generation, err, isFailure)
+		return err
+	}
+}
+
+// StreamClientInterceptor fails streams fast while the breaker is open.
+// Only errors establishing the stream are counted, unless the stream's
+// context is done.  If isFailure is nil, IsServerFailure is used.
+func StreamClientInterceptor(b *Breaker, isFailure IsFailure) grpc.StreamClientInterceptor {
+	if isFailure == nil {
+		isFailure = IsServerFailure
+	}
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		generation, err := b.allow()
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		b.outcome(ctx, generation, err, isFailure)
+		return stream, err
+	}
+}
+
+// outcome reports the result of a request made with ctx, unless the failure
+// is down to ctx.
+func (b *Breaker) outcome(ctx context.Context, generation uint64, err error, isFailure IsFailure) {
+	if err != nil && ctx.Err() != nil {
+		b.ignore(generation)
+		return
+	}
+	b.done(generation, err == nil || !isFailure(err))
+}
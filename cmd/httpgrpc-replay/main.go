@@ -0,0 +1,107 @@
+// Command httpgrpc-replay sends requests captured by the httpgrpc/capture
+// middleware to an httpgrpc target, and prints how its responses differ from
+// the captured ones.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	otgrpc "github.com/opentracing-contrib/go-grpc"
+	"github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+
+	"github.com/videocoin/common/httpgrpc"
+	"github.com/videocoin/common/httpgrpc/capture"
+	"github.com/videocoin/common/httpgrpc/server"
+	"github.com/videocoin/common/middleware"
+)
+
+type stringSlice []string
+
+func (s *stringSlice) String() string     { return strings.Join(*s, ",") }
+func (s *stringSlice) Set(v string) error { *s = append(*s, v); return nil }
+
+func main() {
+	var (
+		file, target  string
+		ignoreHeaders stringSlice
+		setHeaders    stringSlice
+	)
+	flag.StringVar(&file, "file", "", "Capture file to replay.")
+	flag.StringVar(&target, "target", "", "Address of the httpgrpc target, e.g. direct://localhost:9095.")
+	flag.Var(&ignoreHeaders, "ignore-header", "Response header not to compare. May be repeated.")
+	flag.Var(&setHeaders, "header", "Request header to set, as Key=Value. May be repeated.")
+	flag.Parse()
+
+	if err := run(file, target, ignoreHeaders, setHeaders); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(file, target string, ignoreHeaders, setHeaders []string) error {
+	if file == "" || target == "" {
+		return fmt.Errorf("-file and -target are required")
+	}
+
+	headers := map[string]string{}
+	for _, h := range setHeaders {
+		parts := strings.SplitN(h, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid header %q, expected Key=Value", h)
+		}
+		headers[parts[0]] = parts[1]
+	}
+
+	address, err := server.ParseURL(target)
+	if err != nil {
+		return err
+	}
+	// Propagate the org ID of each request like server.NewClient does, or the
+	// target would reject them.
+	conn, err := grpc.Dial(address,
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
+			otgrpc.OpenTracingClientInterceptor(opentracing.GlobalTracer()),
+			middleware.ClientUserHeaderInterceptor,
+		)),
+		grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(
+			otgrpc.OpenTracingStreamClientInterceptor(opentracing.GlobalTracer()),
+			middleware.StreamClientUserHeaderInterceptor,
+		)),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	replayer := capture.Replayer{
+		Client:        httpgrpc.NewHTTPClient(conn),
+		IgnoreHeaders: ignoreHeaders,
+		SetHeaders:    headers,
+	}
+	diffs := 0
+	n, err := replayer.Replay(context.Background(), capture.NewReader(f), func(d capture.Diff) {
+		diffs++
+		fmt.Printf("%s %s\n", d.Request.Method, d.Request.Url)
+		if d.Err != nil {
+			fmt.Printf("  error: %v\n", d.Err)
+		}
+		for _, difference := range d.Differences {
+			fmt.Printf("  %s\n", difference)
+		}
+	})
+	fmt.Printf("%d requests replayed, %d differed\n", n, diffs)
+	return err
+}
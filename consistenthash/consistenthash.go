@@ -0,0 +1,266 @@
+// Package consistenthash provides a gRPC balancer which sends requests with
+// the same key to the same backend, using consistent hashing with bounded
+// loads so that a hot key cannot overload a single backend.
+package consistenthash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/serviceconfig"
+
+	"github.com/videocoin/common/user"
+)
+
+const (
+	// Name of the balancer registered by this package, keyed by org ID.
+	Name = "consistent_hash"
+
+	// DefaultLoadFactor lets a backend take up to 25% more than the average
+	// number of inflight requests before keys spill over to the next one.
+	DefaultLoadFactor = 1.25
+
+	// Number of points each backend gets on the ring.
+	replicas = 100
+)
+
+func init() {
+	balancer.Register(NewBuilder(Name, OrgIDKey))
+}
+
+// KeyFunc extracts the hashing key for a request from its context.  Requests
+// without a key are spread round-robin.
+type KeyFunc func(ctx context.Context) (string, bool)
+
+// OrgIDKey keys requests by the org ID in the context.
+func OrgIDKey(ctx context.Context) (string, bool) {
+	orgID, err := user.ExtractOrgID(ctx)
+	return orgID, err == nil
+}
+
+// Config is the balancer's service config, e.g.
+//
+//	{"loadBalancingConfig": [{"consistent_hash": {"loadFactor": 1.5}}]}
+type Config struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	LoadFactor float64 `json:"loadFactor"`
+}
+
+// ServiceConfig returns the JSON service config selecting the balancer
+// registered as name with the given load factor.
+func ServiceConfig(name string, loadFactor float64) string {
+	return fmt.Sprintf(`{"loadBalancingConfig": [{%q: {"loadFactor": %g}}]}`, name, loadFactor)
+}
+
+// NewBuilder makes a balancer.Builder hashing requests on key.  Register it
+// with balancer.Register to use a custom KeyFunc.
+func NewBuilder(name string, key KeyFunc) balancer.Builder {
+	return &builder{
+		name: name,
+		key:  key,
+	}
+}
+
+// IsBuilder returns true if b was made by NewBuilder, and so takes the
+// service config returned by ServiceConfig.
+func IsBuilder(b balancer.Builder) bool {
+	_, ok := b.(*builder)
+	return ok
+}
+
+type builder struct {
+	name string
+	key  KeyFunc
+}
+
+func (b *builder) Name() string {
+	return b.name
+}
+
+// Build makes a base balancer with a picker builder of its own, so that the
+// inflight counts are per ClientConn.
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &pickerBuilder{
+		key:        b.key,
+		loadFactor: DefaultLoadFactor,
+		loads:      map[string]*int64{},
+	}
+	return &hashBalancer{
+		Balancer: base.NewBalancerBuilder(b.name, pb, base.Config{HealthCheck: true}).Build(cc, opts),
+		pb:       pb,
+	}
+}
+
+// ParseConfig implements balancer.ConfigParser.
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &Config{LoadFactor: DefaultLoadFactor}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("consistenthash: unable to unmarshal config: %v", err)
+	}
+	if cfg.LoadFactor < 1 {
+		return nil, fmt.Errorf("consistenthash: load factor must be >= 1, got %g", cfg.LoadFactor)
+	}
+	return cfg, nil
+}
+
+type hashBalancer struct {
+	balancer.Balancer
+	pb *pickerBuilder
+}
+
+func (b *hashBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	if cfg, ok := s.BalancerConfig.(*Config); ok {
+		b.pb.setLoadFactor(cfg.LoadFactor)
+	}
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+type pickerBuilder struct {
+	key KeyFunc
+
+	mtx        sync.Mutex
+	loadFactor float64
+	// Inflight requests per address, kept across pickers so that the loads
+	// survive endpoints coming and going.
+	loads map[string]*int64
+	total int64
+}
+
+func (pb *pickerBuilder) setLoadFactor(loadFactor float64) {
+	pb.mtx.Lock()
+	defer pb.mtx.Unlock()
+	pb.loadFactor = loadFactor
+}
+
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	pb.mtx.Lock()
+	defer pb.mtx.Unlock()
+
+	p := &picker{
+		key:        pb.key,
+		loadFactor: pb.loadFactor,
+		total:      &pb.total,
+	}
+	seen := make(map[string]bool, len(info.ReadySCs))
+	for sc, sci := range info.ReadySCs {
+		addr := sci.Address.Addr
+		seen[addr] = true
+		load, ok := pb.loads[addr]
+		if !ok {
+			load = new(int64)
+			pb.loads[addr] = load
+		}
+		b := &backend{sc: sc, addr: addr, load: load}
+		p.backends = append(p.backends, b)
+		for i := 0; i < replicas; i++ {
+			p.ring = append(p.ring, point{hash: hash(addr + "#" + strconv.Itoa(i)), backend: b})
+		}
+	}
+	for addr := range pb.loads {
+		if !seen[addr] {
+			delete(pb.loads, addr)
+		}
+	}
+
+	// Sort by address too, so the ring is the same whatever order the
+	// SubConns come in.
+	sort.Slice(p.backends, func(i, j int) bool { return p.backends[i].addr < p.backends[j].addr })
+	sort.Slice(p.ring, func(i, j int) bool {
+		if p.ring[i].hash != p.ring[j].hash {
+			return p.ring[i].hash < p.ring[j].hash
+		}
+		return p.ring[i].backend.addr < p.ring[j].backend.addr
+	})
+	return p
+}
+
+type backend struct {
+	sc   balancer.SubConn
+	addr string
+	load *int64
+}
+
+type point struct {
+	hash    uint64
+	backend *backend
+}
+
+type picker struct {
+	key        KeyFunc
+	loadFactor float64
+	backends   []*backend
+	ring       []point
+	total      *int64
+	next       uint32
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	var b *backend
+	if key, ok := p.key(info.Ctx); ok {
+		b = p.lookup(key)
+	} else {
+		next := atomic.AddUint32(&p.next, 1)
+		b = p.backends[int(next)%len(p.backends)]
+	}
+
+	atomic.AddInt64(b.load, 1)
+	atomic.AddInt64(p.total, 1)
+	return balancer.PickResult{
+		SubConn: b.sc,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(b.load, -1)
+			atomic.AddInt64(p.total, -1)
+		},
+	}, nil
+}
+
+// lookup walks the ring clockwise from the key's hash, and returns the first
+// backend which is not over capacity.  There is always one, since not every
+// backend can be above the average.
+func (p *picker) lookup(key string) *backend {
+	h := hash(key)
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	capacity := p.capacity()
+	for i := 0; i < len(p.ring); i++ {
+		b := p.ring[(start+i)%len(p.ring)].backend
+		if atomic.LoadInt64(b.load) < capacity {
+			return b
+		}
+	}
+	return p.ring[start%len(p.ring)].backend
+}
+
+// capacity is the maximum number of inflight requests a backend may have,
+// counting the request being picked.
+func (p *picker) capacity() int64 {
+	total := atomic.LoadInt64(p.total) + 1
+	return int64(math.Ceil(float64(total) * p.loadFactor / float64(len(p.backends))))
+}
+
+// hash is FNV-1a followed by the splitmix64 finalizer, as FNV alone spreads
+// strings which only differ in their last few bytes poorly.
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,126 @@
+package consistenthash
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/videocoin/common/user"
+)
+
+type fakeSubConn struct {
+	addr string
+}
+
+func (*fakeSubConn) UpdateAddresses([]resolver.Address) {}
+func (*fakeSubConn) Connect()                           {}
+
+func buildPicker(pb *pickerBuilder, addrs ...string) *picker {
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+	for _, addr := range addrs {
+		info.ReadySCs[&fakeSubConn{addr: addr}] = base.SubConnInfo{Address: resolver.Address{Addr: addr}}
+	}
+	return pb.Build(info).(*picker)
+}
+
+func newPickerBuilder() *pickerBuilder {
+	return &pickerBuilder{
+		key:        OrgIDKey,
+		loadFactor: DefaultLoadFactor,
+		loads:      map[string]*int64{},
+	}
+}
+
+func pick(t *testing.T, p balancer.Picker, orgID string) (string, func(balancer.DoneInfo)) {
+	ctx := context.Background()
+	if orgID != "" {
+		ctx = user.InjectOrgID(ctx, orgID)
+	}
+	res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+	require.NoError(t, err)
+	return res.SubConn.(*fakeSubConn).addr, res.Done
+}
+
+func TestAffinity(t *testing.T) {
+	p := buildPicker(newPickerBuilder(), "a", "b", "c")
+
+	for i := 0; i < 100; i++ {
+		orgID := fmt.Sprintf("org-%d", i)
+		first, done := pick(t, p, orgID)
+		done(balancer.DoneInfo{})
+		second, done := pick(t, p, orgID)
+		done(balancer.DoneInfo{})
+		assert.Equal(t, first, second, orgID)
+	}
+}
+
+func TestChurn(t *testing.T) {
+	pb := newPickerBuilder()
+	before := buildPicker(pb, "a", "b", "c", "d")
+	after := buildPicker(pb, "a", "b", "c")
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		orgID := fmt.Sprintf("org-%d", i)
+		addrBefore, done := pick(t, before, orgID)
+		done(balancer.DoneInfo{})
+		addrAfter, done := pick(t, after, orgID)
+		done(balancer.DoneInfo{})
+		if addrBefore != "d" {
+			assert.Equal(t, addrBefore, addrAfter, orgID)
+		} else {
+			moved++
+		}
+	}
+	// Roughly a quarter of the keys lived on the removed backend.
+	assert.InDelta(t, 250, moved, 100)
+}
+
+func TestBoundedLoad(t *testing.T) {
+	p := buildPicker(newPickerBuilder(), "a", "b", "c", "d")
+
+	// A single hot org spills over to other backends rather than piling
+	// all its requests onto one.
+	counts := map[string]int{}
+	for i := 0; i < 100; i++ {
+		addr, _ := pick(t, p, "hot")
+		counts[addr]++
+	}
+	for addr, count := range counts {
+		assert.LessOrEqual(t, count, 32, addr)
+	}
+	assert.Len(t, counts, 4)
+}
+
+func TestNoKey(t *testing.T) {
+	p := buildPicker(newPickerBuilder(), "a", "b")
+
+	counts := map[string]int{}
+	for i := 0; i < 10; i++ {
+		addr, done := pick(t, p, "")
+		done(balancer.DoneInfo{})
+		counts[addr]++
+	}
+	assert.Equal(t, map[string]int{"a": 5, "b": 5}, counts)
+}
+
+func TestParseConfig(t *testing.T) {
+	b := NewBuilder(Name, OrgIDKey).(balancer.ConfigParser)
+
+	cfg, err := b.ParseConfig([]byte(`{"loadFactor": 1.5}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, cfg.(*Config).LoadFactor)
+
+	_, err = b.ParseConfig([]byte(`{"loadFactor": 0.5}`))
+	assert.Error(t, err)
+
+	assert.True(t, IsBuilder(NewBuilder("custom", OrgIDKey)))
+	assert.False(t, IsBuilder(balancer.Get(roundrobin.Name)))
+}
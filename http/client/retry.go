@@ -0,0 +1,154 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/videocoin/common/backoff"
+)
+
+// RetryingRoundTripper is a http.RoundTripper which retries idempotent
+// requests on network errors, and on 429, 502, 503 and 504 responses.  The
+// Retry-After header of responses is honoured if it asks for a longer delay
+// than the policy, up to the policy's maximum interval; responses asking for
+// more are returned.
+type RetryingRoundTripper struct {
+	next   Requester
+	policy backoff.RetryPolicy
+	clock  backoff.Clock
+}
+
+// NewRetryingRoundTripper makes a RetryingRoundTripper, which makes each
+// attempt with next.  next can be a TimedClient, so that each attempt is
+// measured, wrapping a http.Client with the actual transport.
+func NewRetryingRoundTripper(next Requester, policy backoff.RetryPolicy) *RetryingRoundTripper {
+	return &RetryingRoundTripper{
+		next:   next,
+		policy: policy,
+		clock:  backoff.SystemClock,
+	}
+}
+
+// SetClock sets the clock used to wait between attempts.
+func (t *RetryingRoundTripper) SetClock(c backoff.Clock) {
+	t.clock = c
+}
+
+// Do implements Requester.
+func (t *RetryingRoundTripper) Do(req *http.Request) (*http.Response, error) {
+	return t.RoundTrip(req)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !canRetry(req) {
+		return t.next.Do(req)
+	}
+
+	ctx := req.Context()
+	retrier := backoff.NewRetrier(t.policy, t.clock)
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 {
+			// Each attempt needs its own copy of the body.
+			attemptReq = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+
+		resp, err := t.next.Do(attemptReq)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			backoff.RecordSuccess(t.policy)
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return resp, err
+		}
+
+		next := retrier.NextBackOff()
+		if next == backoff.Done {
+			return resp, err
+		}
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), t.clock.Now()); ok && retryAfter > next {
+				if max := backoff.MaximumInterval(t.policy); max != backoff.NoInterval && retryAfter > max {
+					// The server asks for longer than we are willing to wait.
+					return resp, nil
+				}
+				next = retryAfter
+			}
+			if deadline, ok := ctx.Deadline(); ok && t.clock.Now().Add(next).After(deadline) {
+				// Waiting would be pointless, the response is better than nothing.
+				return resp, nil
+			}
+			drain(resp.Body)
+		}
+
+		timer := t.clock.NewTimer(next)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			if err != nil {
+				return nil, fmt.Errorf("%w, last error: %w", ctx.Err(), err)
+			}
+			return nil, fmt.Errorf("%w, last response: %s", ctx.Err(), resp.Status)
+		}
+	}
+}
+
+// canRetry returns true if req is idempotent, and its body can be sent again.
+func canRetry(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	// Same as net/http.
+	_, hasIdempotencyKey := req.Header["Idempotency-Key"]
+	_, hasXIdempotencyKey := req.Header["X-Idempotency-Key"]
+	return hasIdempotencyKey || hasXIdempotencyKey
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses both forms of the Retry-After header: a number of
+// seconds, or a HTTP date, which is relative to now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now), true
+	}
+	return 0, false
+}
+
+// drain and close body, so that its connection can be reused.
+func drain(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, 4096))
+	body.Close()
+}
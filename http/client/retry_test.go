@@ -0,0 +1,218 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/videocoin/common/backoff"
+	"github.com/videocoin/common/instrument"
+)
+
+// failingServer responds with code to the first failures requests, and
+// records the bodies it receives.
+func failingServer(failures, code int, retryAfter string) (*httptest.Server, *[]string) {
+	var bodies []string
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(code)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})), &bodies
+}
+
+func testPolicy() backoff.RetryPolicy {
+	policy := backoff.NewConstantRetryPolicy(time.Millisecond)
+	policy.SetMaximumAttempts(3)
+	return policy
+}
+
+func TestRetryingRoundTripper(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		method   string
+		header   http.Header
+		failures int
+		code     int
+		expected int
+		requests int
+	}{
+		{name: "success", method: "GET", expected: 200, requests: 1},
+		{name: "retried", method: "GET", failures: 2, code: 503, expected: 200, requests: 3},
+		{name: "exhausted", method: "GET", failures: 10, code: 429, expected: 429, requests: 4},
+		{name: "not retryable status", method: "GET", failures: 1, code: 500, expected: 500, requests: 1},
+		{name: "put body rewound", method: "PUT", failures: 1, code: 502, expected: 200, requests: 2},
+		{name: "post not idempotent", method: "POST", failures: 1, code: 504, expected: 504, requests: 1},
+		{name: "post with idempotency key", method: "POST", header: http.Header{"Idempotency-Key": {"1"}}, failures: 1, code: 504, expected: 200, requests: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, bodies := failingServer(tc.failures, tc.code, "")
+			defer server.Close()
+
+			client := &http.Client{Transport: NewRetryingRoundTripper(&http.Client{}, testPolicy())}
+			req, err := http.NewRequest(tc.method, server.URL, strings.NewReader("body"))
+			require.NoError(t, err)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tc.expected, resp.StatusCode)
+			require.Len(t, *bodies, tc.requests)
+			for _, body := range *bodies {
+				assert.Equal(t, "body", body)
+			}
+		})
+	}
+}
+
+func TestRetryingRoundTripperUnrewindableBody(t *testing.T) {
+	server, bodies := failingServer(1, 503, "")
+	defer server.Close()
+
+	req, err := http.NewRequest("PUT", server.URL, ioutil.NopCloser(bytes.NewReader([]byte("body"))))
+	require.NoError(t, err)
+	resp, err := NewRetryingRoundTripper(&http.Client{}, testPolicy()).RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Len(t, *bodies, 1)
+}
+
+// roundTrip req with a FakeClock, calling wait once the round tripper waits
+// before its next attempt.
+func roundTrip(req *http.Request, wait func(*backoff.FakeClock)) (*http.Response, error) {
+	clock := backoff.NewFakeClock(time.Now())
+	rt := NewRetryingRoundTripper(&http.Client{}, testPolicy())
+	rt.SetClock(clock)
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := rt.RoundTrip(req)
+		done <- result{resp, err}
+	}()
+	if wait != nil {
+		clock.BlockUntil(1)
+		wait(clock)
+	}
+	r := <-done
+	return r.resp, r.err
+}
+
+func TestRetryingRoundTripperRetryAfter(t *testing.T) {
+	server, bodies := failingServer(1, 429, "5")
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	resp, err := roundTrip(req, func(clock *backoff.FakeClock) {
+		clock.Advance(4 * time.Second)
+		assert.Len(t, *bodies, 1)
+		clock.Advance(time.Second)
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Len(t, *bodies, 2)
+
+	// Not worth waiting beyond the policy's maximum interval.
+	server, bodies = failingServer(1, 429, "60")
+	defer server.Close()
+	req, err = http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	resp, err = roundTrip(req, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Len(t, *bodies, 1)
+
+	// Nor beyond the deadline.
+	server, bodies = failingServer(1, 429, "5")
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err = http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	require.NoError(t, err)
+	resp, err = roundTrip(req, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Len(t, *bodies, 1)
+}
+
+func TestRetryingRoundTripperCanceled(t *testing.T) {
+	server, _ := failingServer(1, 503, "")
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	require.NoError(t, err)
+	_, err = roundTrip(req, func(*backoff.FakeClock) { cancel() })
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Contains(t, err.Error(), "503 Service Unavailable")
+
+	// Transport errors are kept too.
+	server.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	req, err = http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	require.NoError(t, err)
+	_, err = roundTrip(req, func(*backoff.FakeClock) { cancel() })
+	assert.True(t, errors.Is(err, context.Canceled))
+	var urlErr *url.Error
+	assert.True(t, errors.As(err, &urlErr))
+}
+
+func TestRetryingRoundTripperTimedAttempts(t *testing.T) {
+	server, _ := failingServer(2, 503, "")
+	defer server.Close()
+
+	hist := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "test_request_duration_seconds",
+	}, []string{"operation", "status_code"})
+	timed := NewTimedClient(&http.Client{}, instrument.NewHistogramCollector(hist))
+	client := &http.Client{Transport: NewRetryingRoundTripper(timed, testPolicy())}
+
+	resp, err := client.Get(server.URL + "/path")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 2, testutil.CollectAndCount(hist))
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+	d, ok := parseRetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, d)
+
+	d, ok = parseRetryAfter(now.Add(time.Hour).UTC().Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour.Seconds(), d.Seconds(), 2)
+
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
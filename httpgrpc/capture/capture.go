@@ -0,0 +1,253 @@
+// Package capture records a sample of HTTP requests and their responses as
+// httpgrpc messages, so that they can be replayed against another target
+// later on.
+//
+// Capture files are a sequence of records, each of which is an HTTPRequest
+// followed by its HTTPResponse, both varint length-delimited.
+package capture
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+
+	"github.com/felixge/httpsnoop"
+	protoio "github.com/gogo/protobuf/io"
+
+	"github.com/videocoin/common/httpgrpc"
+	"github.com/videocoin/common/logging"
+)
+
+const (
+	// Redacted replaces the values of redacted headers.
+	Redacted = logging.Redacted
+
+	// TruncatedHeader is added to captured requests and responses whose body
+	// was cut at MaxBodySize, see IsTruncated.
+	TruncatedHeader = "X-Capture-Truncated"
+
+	// DefaultMaxBodySize is the MaxBodySize used when it is not set.
+	DefaultMaxBodySize = 1024 * 1024
+
+	// maxMessageSize is the largest message a Reader accepts.
+	maxMessageSize = 64 * 1024 * 1024
+)
+
+// Config for Capture.
+type Config struct {
+	Path        string  `yaml:"path"`
+	SampleRate  float64 `yaml:"sample_rate"`
+	MaxFileSize int64   `yaml:"max_file_size"`
+	MaxFiles    int     `yaml:"max_files"`
+	// MaxBodySize is the number of bytes of each request and response body
+	// captured; longer bodies are truncated.  0 means DefaultMaxBodySize.
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// RedactHeaders are redacted in addition to logging.DefaultRedactHeaders.
+	RedactHeaders []string `yaml:"redact_headers"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Path, "capture.path", "", "File to capture sampled requests and responses to. Capture is disabled if empty.")
+	f.Float64Var(&cfg.SampleRate, "capture.sample-rate", 0.01, "Fraction of requests to capture.")
+	f.Int64Var(&cfg.MaxFileSize, "capture.max-file-size", 100*1024*1024, "Size (in bytes) at which the capture file is rotated, <=0 to never rotate.")
+	f.IntVar(&cfg.MaxFiles, "capture.max-files", 5, "Number of rotated capture files to keep.")
+	f.Int64Var(&cfg.MaxBodySize, "capture.max-body-size", DefaultMaxBodySize, "Bytes of each request and response body to capture; longer bodies are truncated.")
+}
+
+// Capture is a middleware which writes a sample of requests and their
+// responses to a rotating file.
+type Capture struct {
+	cfg      Config
+	log      logging.Interface
+	file     *rotatingFile
+	redactor *logging.Redactor
+}
+
+// New makes a new Capture, writing to cfg.Path.  Call Close once done with it.
+func New(cfg Config, log logging.Interface) (*Capture, error) {
+	redactor, err := logging.NewRedactor(logging.RedactConfig{Headers: cfg.RedactHeaders})
+	if err != nil {
+		return nil, err
+	}
+	file, err := openRotatingFile(cfg.Path, cfg.MaxFileSize, cfg.MaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	return &Capture{
+		cfg:      cfg,
+		log:      log,
+		file:     file,
+		redactor: redactor,
+	}, nil
+}
+
+// Close the capture file.
+func (c *Capture) Close() error {
+	return c.file.Close()
+}
+
+// Wrap implements middleware.Interface
+func (c *Capture) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= c.cfg.SampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Read one byte more than captured, to tell whether the body is
+		// truncated, and put back what we read for next.
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, c.cfg.MaxBodySize+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+		req := &httpgrpc.HTTPRequest{
+			Method:  r.Method,
+			Url:     r.RequestURI,
+			Headers: c.headers(r.Header),
+			Body:    body,
+		}
+		if int64(len(body)) > c.cfg.MaxBodySize {
+			req.Body = body[:c.cfg.MaxBodySize]
+			req.Headers = markTruncated(req.Headers)
+		}
+
+		code := http.StatusOK
+		respBody := limitedBuffer{limit: c.cfg.MaxBodySize}
+		ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(statusCode int) {
+					code = statusCode
+					next(statusCode)
+				}
+			},
+			Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+				return func(b []byte) (int, error) {
+					n, err := next(b)
+					respBody.Write(b[:n])
+					return n, err
+				}
+			},
+		})
+		next.ServeHTTP(ww, r)
+
+		resp := &httpgrpc.HTTPResponse{
+			Code:    int32(code),
+			Headers: c.headers(w.Header()),
+			Body:    respBody.Bytes(),
+		}
+		if respBody.truncated {
+			resp.Headers = markTruncated(resp.Headers)
+		}
+		if err := writeRecord(c.file, req, resp); err != nil {
+			c.log.Warnf("Failed to capture request: %v", err)
+		}
+	})
+}
+
+func markTruncated(headers []*httpgrpc.Header) []*httpgrpc.Header {
+	return append(headers, &httpgrpc.Header{Key: TruncatedHeader, Values: []string{"true"}})
+}
+
+// IsTruncated returns true if the captured request or response with headers
+// had its body truncated.
+func IsTruncated(headers []*httpgrpc.Header) bool {
+	for _, h := range headers {
+		if h.Key == TruncatedHeader {
+			return true
+		}
+	}
+	return false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedBuffer keeps the first limit bytes written to it, and discards the
+// rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.Len()); int64(len(p)) > room {
+		b.truncated = true
+		p = p[:room]
+	}
+	return b.Buffer.Write(p)
+}
+
+// writeRecord with a single Write, so it never straddles two files.
+func writeRecord(w io.Writer, req *httpgrpc.HTTPRequest, resp *httpgrpc.HTTPResponse) error {
+	var buf bytes.Buffer
+	dw := protoio.NewDelimitedWriter(&buf)
+	if err := dw.WriteMsg(req); err != nil {
+		return err
+	}
+	if err := dw.WriteMsg(resp); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// headers converts hs, in a stable order and redacted as by
+// logging.Redactor.Header.
+func (c *Capture) headers(hs http.Header) []*httpgrpc.Header {
+	hs = c.redactor.Header(hs)
+	keys := make([]string, 0, len(hs))
+	for k := range hs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]*httpgrpc.Header, 0, len(hs))
+	for _, k := range keys {
+		result = append(result, &httpgrpc.Header{
+			Key:    k,
+			Values: hs[k],
+		})
+	}
+	return result
+}
+
+// Reader reads records from a capture file.
+type Reader struct {
+	r protoio.ReadCloser
+}
+
+// NewReader makes a new Reader.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r: protoio.NewDelimitedReader(r, maxMessageSize),
+	}
+}
+
+// Next returns the next record, or io.EOF at the end of the file.
+func (r *Reader) Next() (*httpgrpc.HTTPRequest, *httpgrpc.HTTPResponse, error) {
+	var req httpgrpc.HTTPRequest
+	if err := r.r.ReadMsg(&req); err != nil {
+		return nil, nil, err
+	}
+	var resp httpgrpc.HTTPResponse
+	if err := r.r.ReadMsg(&resp); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+	return &req, &resp, nil
+}
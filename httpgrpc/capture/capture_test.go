@@ -0,0 +1,239 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/videocoin/common/httpgrpc"
+	"github.com/videocoin/common/logging"
+	"github.com/videocoin/common/user"
+)
+
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Header().Set("Set-Cookie", "secret")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "%s %s", r.RequestURI, body)
+}
+
+func TestCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+	c, err := New(Config{
+		Path:          path,
+		SampleRate:    1,
+		RedactHeaders: []string{"X-Api-Key"},
+	}, logging.Noop())
+	require.NoError(t, err)
+
+	handler := c.Wrap(http.HandlerFunc(echoHandler))
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", fmt.Sprintf("/foo/%d", i), bytes.NewBufferString("hello"))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("X-Api-Key", "key")
+		req.Header.Set("Accept", "text/plain")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		// The handler still sees the body.
+		assert.Equal(t, fmt.Sprintf("/foo/%d hello", i), recorder.Body.String())
+	}
+	require.NoError(t, c.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	r := NewReader(f)
+	for i := 0; i < 3; i++ {
+		req, resp, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, fmt.Sprintf("/foo/%d", i), req.Url)
+		assert.Equal(t, "hello", string(req.Body))
+		assert.Equal(t, []*httpgrpc.Header{
+			{Key: "Accept", Values: []string{"text/plain"}},
+			{Key: "Authorization", Values: []string{Redacted}},
+			{Key: "X-Api-Key", Values: []string{Redacted}},
+		}, req.Headers)
+
+		assert.Equal(t, int32(http.StatusCreated), resp.Code)
+		assert.Equal(t, fmt.Sprintf("/foo/%d hello", i), string(resp.Body))
+		assert.Contains(t, resp.Headers, &httpgrpc.Header{Key: "Set-Cookie", Values: []string{Redacted}})
+	}
+	_, _, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+	f, err := openRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, s := range []string{"aaaaaa", "bbbbbb", "cccccc", "dddddd"} {
+		_, err := f.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	for file, expected := range map[string]string{
+		path:        "dddddd",
+		path + ".1": "cccccc",
+		path + ".2": "bbbbbb",
+	} {
+		content, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRotationFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+	// path cannot be moved onto a non-empty directory.
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "dir"), 0700))
+	f, err := openRotatingFile(path, 10, 1)
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("aaaaaa"))
+	require.NoError(t, err)
+	_, err = f.Write([]byte("bbbbbb"))
+	assert.Error(t, err)
+	// Later writes still go to path.
+	_, err = f.Write([]byte("cccccc"))
+	assert.Error(t, err)
+	require.NoError(t, f.Close())
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaaabbbbbbcccccc", string(content))
+}
+
+type fakeClient func(*httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error)
+
+func (f fakeClient) Handle(ctx context.Context, req *httpgrpc.HTTPRequest, _ ...grpc.CallOption) (*httpgrpc.HTTPResponse, error) {
+	return f(req)
+}
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	for _, url := range []string{"/same", "/different", "/error"} {
+		require.NoError(t, writeRecord(&buf,
+			&httpgrpc.HTTPRequest{Method: "GET", Url: url, Headers: []*httpgrpc.Header{{Key: "Authorization", Values: []string{Redacted}}}},
+			&httpgrpc.HTTPResponse{Code: 200, Body: []byte("ok"), Headers: []*httpgrpc.Header{{Key: "Date", Values: []string{"yesterday"}}}},
+		))
+	}
+
+	replayer := Replayer{
+		Client: fakeClient(func(req *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+			assert.Equal(t, []*httpgrpc.Header{{Key: "Authorization", Values: []string{"Bearer replay"}}}, req.Headers)
+			switch req.Url {
+			case "/different":
+				return &httpgrpc.HTTPResponse{Code: 200, Body: []byte("not ok")}, nil
+			case "/error":
+				return nil, httpgrpc.Errorf(500, "boom")
+			}
+			return &httpgrpc.HTTPResponse{Code: 200, Body: []byte("ok"), Headers: []*httpgrpc.Header{{Key: "Date", Values: []string{"today"}}}}, nil
+		}),
+		IgnoreHeaders: []string{"date"},
+		SetHeaders:    map[string]string{"authorization": "Bearer replay"},
+	}
+
+	var diffs []Diff
+	n, err := replayer.Replay(context.Background(), NewReader(&buf), func(d Diff) {
+		diffs = append(diffs, d)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	require.Len(t, diffs, 2)
+	assert.Equal(t, "/different", diffs[0].Request.Url)
+	assert.Equal(t, []string{`body: expected "ok", got "not ok"`}, diffs[0].Differences)
+	assert.Equal(t, "/error", diffs[1].Request.Url)
+	assert.Equal(t, []string{
+		`status code: expected 200, got 500`,
+		`body: expected "ok", got "boom"`,
+	}, diffs[1].Differences)
+}
+
+func TestReplayInjectsOrgID(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeRecord(&buf,
+		&httpgrpc.HTTPRequest{Method: "GET", Url: "/", Headers: []*httpgrpc.Header{{Key: user.OrgIDHeaderName, Values: []string{"1"}}}},
+		&httpgrpc.HTTPResponse{Code: 200},
+	))
+
+	var orgID string
+	replayer := Replayer{
+		Client: contextClient(func(ctx context.Context) {
+			orgID, _ = user.ExtractOrgID(ctx)
+		}),
+		SetHeaders: map[string]string{user.OrgIDHeaderName: "2"},
+	}
+	_, err := replayer.Replay(context.Background(), NewReader(&buf), func(Diff) {})
+	require.NoError(t, err)
+	assert.Equal(t, "2", orgID)
+}
+
+type contextClient func(context.Context)
+
+func (f contextClient) Handle(ctx context.Context, req *httpgrpc.HTTPRequest, _ ...grpc.CallOption) (*httpgrpc.HTTPResponse, error) {
+	f(ctx)
+	return &httpgrpc.HTTPResponse{Code: 200}, nil
+}
+
+func TestCaptureTruncatesBodies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+	c, err := New(Config{
+		Path:        path,
+		SampleRate:  1,
+		MaxBodySize: 8,
+	}, logging.Noop())
+	require.NoError(t, err)
+
+	handler := c.Wrap(http.HandlerFunc(echoHandler))
+	req := httptest.NewRequest("POST", "/foo", bytes.NewBufferString("hello world"))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.NoError(t, c.Close())
+
+	// The handler and client still see the whole bodies.
+	assert.Equal(t, "/foo hello world", recorder.Body.String())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	capturedReq, capturedResp, err := NewReader(f).Next()
+	require.NoError(t, err)
+	assert.Equal(t, "hello wo", string(capturedReq.Body))
+	assert.True(t, IsTruncated(capturedReq.Headers))
+	assert.Equal(t, "/foo hel", string(capturedResp.Body))
+	assert.True(t, IsTruncated(capturedResp.Headers))
+
+	// Truncated records are not replayed.
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	var diffs []Diff
+	n, err := Replayer{
+		Client: fakeClient(func(req *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+			t.Fatal("truncated request replayed")
+			return nil, nil
+		}),
+	}.Replay(context.Background(), NewReader(f), func(d Diff) { diffs = append(diffs, d) })
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, ErrTruncated, diffs[0].Err)
+}
@@ -0,0 +1,166 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/videocoin/common/httpgrpc"
+	"github.com/videocoin/common/user"
+)
+
+// ErrTruncated is reported for records whose request or response body was
+// truncated when captured: they are not replayed, as the request would be
+// corrupt and the response could not be compared.
+var ErrTruncated = errors.New("body truncated when captured, not replayable")
+
+// Diff describes how the response to a replayed request differs from the
+// captured one.
+type Diff struct {
+	Request  *httpgrpc.HTTPRequest
+	Expected *httpgrpc.HTTPResponse
+	Actual   *httpgrpc.HTTPResponse
+	// Err is set if the request could not be replayed at all.
+	Err         error
+	Differences []string
+}
+
+// Replayer sends captured requests to a target, and compares its responses
+// with the captured ones.
+type Replayer struct {
+	Client httpgrpc.HTTPClient
+	// IgnoreHeaders are not compared, e.g. Date.
+	IgnoreHeaders []string
+	// SetHeaders override request headers, e.g. to replace redacted values.
+	SetHeaders map[string]string
+}
+
+// Replay every record from r, calling report for each one whose response
+// differs.  The org ID of each request, from its captured or set headers, is
+// injected into its context, for clients propagating it as gRPC metadata.
+// Truncated records are reported with ErrTruncated instead of being replayed.
+// Returns the number of requests replayed.
+func (p Replayer) Replay(ctx context.Context, r *Reader, report func(Diff)) (int, error) {
+	n := 0
+	for {
+		req, expected, err := r.Next()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		if IsTruncated(req.Headers) || IsTruncated(expected.Headers) {
+			report(Diff{Request: req, Expected: expected, Err: ErrTruncated})
+			continue
+		}
+		n++
+
+		p.setHeaders(req)
+		actual, err := p.Client.Handle(orgIDContext(ctx, req), req)
+		if err != nil {
+			// 5xx responses come back as errors.
+			var ok bool
+			if actual, ok = httpgrpc.HTTPResponseFromError(err); !ok {
+				report(Diff{Request: req, Expected: expected, Err: err})
+				continue
+			}
+		}
+
+		if differences := Compare(expected, actual, p.IgnoreHeaders); len(differences) > 0 {
+			report(Diff{
+				Request:     req,
+				Expected:    expected,
+				Actual:      actual,
+				Differences: differences,
+			})
+		}
+	}
+}
+
+// orgIDContext returns ctx with the org ID of req injected, if it has one.
+func orgIDContext(ctx context.Context, req *httpgrpc.HTTPRequest) context.Context {
+	for _, h := range req.Headers {
+		if http.CanonicalHeaderKey(h.Key) == http.CanonicalHeaderKey(user.OrgIDHeaderName) && len(h.Values) > 0 {
+			return user.InjectOrgID(ctx, h.Values[0])
+		}
+	}
+	return ctx
+}
+
+func (p Replayer) setHeaders(req *httpgrpc.HTTPRequest) {
+	for k, v := range p.SetHeaders {
+		k = http.CanonicalHeaderKey(k)
+		found := false
+		for _, h := range req.Headers {
+			if http.CanonicalHeaderKey(h.Key) == k {
+				h.Values = []string{v}
+				found = true
+			}
+		}
+		if !found {
+			req.Headers = append(req.Headers, &httpgrpc.Header{Key: k, Values: []string{v}})
+		}
+	}
+}
+
+// Compare returns a description of each difference between two responses.
+func Compare(expected, actual *httpgrpc.HTTPResponse, ignoreHeaders []string) []string {
+	var differences []string
+	if expected.Code != actual.Code {
+		differences = append(differences, fmt.Sprintf("status code: expected %d, got %d", expected.Code, actual.Code))
+	}
+
+	ignore := map[string]bool{}
+	for _, h := range ignoreHeaders {
+		ignore[http.CanonicalHeaderKey(h)] = true
+	}
+	expectedHeaders, actualHeaders := headerMap(expected.Headers), headerMap(actual.Headers)
+	keys := map[string]struct{}{}
+	for k := range expectedHeaders {
+		keys[k] = struct{}{}
+	}
+	for k := range actualHeaders {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		if !ignore[k] {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		e, a := strings.Join(expectedHeaders[k], ", "), strings.Join(actualHeaders[k], ", ")
+		if e != a {
+			differences = append(differences, fmt.Sprintf("header %s: expected %q, got %q", k, e, a))
+		}
+	}
+
+	if !bytes.Equal(expected.Body, actual.Body) {
+		differences = append(differences, fmt.Sprintf("body: expected %q, got %q", truncate(expected.Body), truncate(actual.Body)))
+	}
+	return differences
+}
+
+func headerMap(hs []*httpgrpc.Header) map[string][]string {
+	result := make(map[string][]string, len(hs))
+	for _, h := range hs {
+		k := http.CanonicalHeaderKey(h.Key)
+		result[k] = append(result[k], h.Values...)
+	}
+	return result
+}
+
+func truncate(b []byte) []byte {
+	const max = 256
+	if len(b) > max {
+		return append(b[:max:max], "..."...)
+	}
+	return b
+}
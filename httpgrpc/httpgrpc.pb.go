@@ -215,26 +215,27 @@ func init() {
 func init() { proto.RegisterFile("httpgrpc/httpgrpc.proto", fileDescriptor_6670c8e151665986) }
 
 var fileDescriptor_6670c8e151665986 = []byte{
-	// 295 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0xcf, 0x28, 0x29, 0x29,
-	0x48, 0x2f, 0x2a, 0x48, 0xd6, 0x87, 0x31, 0xf4, 0x0a, 0x8a, 0xf2, 0x4b, 0xf2, 0x85, 0x38, 0x60,
-	0x7c, 0xa5, 0x72, 0x2e, 0x6e, 0x8f, 0x90, 0x90, 0x80, 0xa0, 0xd4, 0xc2, 0xd2, 0xd4, 0xe2, 0x12,
-	0x21, 0x31, 0x2e, 0xb6, 0xdc, 0xd4, 0x92, 0x8c, 0xfc, 0x14, 0x09, 0x46, 0x05, 0x46, 0x0d, 0xce,
-	0x20, 0x28, 0x4f, 0x48, 0x80, 0x8b, 0xb9, 0xb4, 0x28, 0x47, 0x82, 0x09, 0x2c, 0x08, 0x62, 0x0a,
-	0x69, 0x71, 0xb1, 0x67, 0xa4, 0x26, 0xa6, 0xa4, 0x16, 0x15, 0x4b, 0x30, 0x2b, 0x30, 0x6b, 0x70,
-	0x1b, 0x09, 0xe8, 0xc1, 0x2d, 0xf1, 0x00, 0x4b, 0x04, 0xc1, 0x14, 0x08, 0x09, 0x71, 0xb1, 0x24,
-	0xe5, 0xa7, 0x54, 0x4a, 0xb0, 0x28, 0x30, 0x6a, 0xf0, 0x04, 0x81, 0xd9, 0x4a, 0x49, 0x5c, 0x3c,
-	0x10, 0x8b, 0x8b, 0x0b, 0xf2, 0xf3, 0x8a, 0x53, 0x41, 0x6a, 0x9c, 0xf3, 0x53, 0x52, 0xc1, 0xf6,
-	0xb2, 0x06, 0x81, 0xd9, 0xc8, 0x76, 0x30, 0x11, 0x6b, 0x07, 0x33, 0x92, 0x1d, 0x46, 0x5c, 0x6c,
-	0x10, 0x65, 0x20, 0xf7, 0x67, 0xa7, 0x56, 0x42, 0x3d, 0x05, 0x62, 0x82, 0x7c, 0x5a, 0x96, 0x98,
-	0x53, 0x9a, 0x0a, 0x31, 0x9a, 0x33, 0x08, 0xca, 0x33, 0x72, 0xe4, 0x62, 0x01, 0xb9, 0x4b, 0xc8,
-	0x92, 0x8b, 0xcd, 0x23, 0x31, 0x2f, 0x25, 0x27, 0x55, 0x48, 0x14, 0xc9, 0x52, 0x44, 0x50, 0x49,
-	0x89, 0xa1, 0x0b, 0x43, 0x3c, 0xa2, 0xc4, 0xe0, 0x64, 0x77, 0xe1, 0xa1, 0x1c, 0xc3, 0x8d, 0x87,
-	0x72, 0x0c, 0x1f, 0x1e, 0xca, 0x31, 0x36, 0x3c, 0x92, 0x63, 0x5c, 0xf1, 0x48, 0x8e, 0xf1, 0xc4,
-	0x23, 0x39, 0xc6, 0x0b, 0x8f, 0xe4, 0x18, 0x1f, 0x3c, 0x92, 0x63, 0x7c, 0xf1, 0x48, 0x8e, 0xe1,
-	0xc3, 0x23, 0x39, 0xc6, 0x09, 0x8f, 0xe5, 0x18, 0x2e, 0x3c, 0x96, 0x63, 0xb8, 0xf1, 0x58, 0x8e,
-	0x21, 0x0a, 0x1e, 0x27, 0x49, 0x6c, 0xe0, 0x48, 0x32, 0x06, 0x04, 0x00, 0x00, 0xff, 0xff, 0xd9,
-	0x2e, 0xd7, 0x22, 0xbf, 0x01, 0x00, 0x00,
+	// 316 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x91, 0xbf, 0x4e, 0x32, 0x41,
+	0x10, 0xc0, 0x77, 0x38, 0xbe, 0xfb, 0x64, 0xa0, 0x20, 0x9b, 0x88, 0x17, 0x8b, 0x09, 0xa1, 0xba,
+	0x58, 0xa0, 0x39, 0x2b, 0x0b, 0x4d, 0xd4, 0x86, 0xc4, 0xc6, 0x6c, 0xa8, 0xec, 0xc0, 0xdb, 0x48,
+	0xe2, 0x79, 0x7b, 0xde, 0x1f, 0x0d, 0x9d, 0x8f, 0xe0, 0x63, 0xf8, 0x28, 0x96, 0x94, 0x94, 0xb2,
+	0x34, 0x96, 0x3c, 0x82, 0xd9, 0xbd, 0x03, 0x89, 0x95, 0x76, 0xbf, 0x99, 0x9d, 0xcc, 0x6f, 0x66,
+	0x07, 0xf7, 0x26, 0x79, 0x9e, 0xdc, 0xa5, 0xc9, 0xed, 0xe1, 0x1a, 0xfa, 0x49, 0xaa, 0x72, 0xc5,
+	0x77, 0xd6, 0x71, 0xef, 0x19, 0x9b, 0x83, 0xe1, 0xf0, 0x5a, 0xc8, 0xc7, 0x42, 0x66, 0x39, 0xef,
+	0xa0, 0xfb, 0x20, 0xf3, 0x89, 0x0a, 0x3d, 0xe8, 0x82, 0xdf, 0x10, 0x55, 0xc4, 0xdb, 0xe8, 0x14,
+	0x69, 0xe4, 0xd5, 0x6c, 0xd2, 0x20, 0x3f, 0xc0, 0xff, 0x13, 0x39, 0x0a, 0x65, 0x9a, 0x79, 0x4e,
+	0xd7, 0xf1, 0x9b, 0x41, 0xbb, 0xbf, 0x91, 0x0c, 0xec, 0x83, 0x58, 0x17, 0x70, 0x8e, 0xf5, 0xb1,
+	0x0a, 0xa7, 0x5e, 0xbd, 0x0b, 0x7e, 0x4b, 0x58, 0xee, 0x8d, 0xb1, 0x55, 0x8a, 0xb3, 0x44, 0xc5,
+	0x99, 0x34, 0x35, 0x97, 0x2a, 0x94, 0xd6, 0xfb, 0x4f, 0x58, 0xde, 0x76, 0xd4, 0x7e, 0xeb, 0x70,
+	0xb6, 0x1c, 0x01, 0xba, 0x65, 0x99, 0x99, 0xff, 0x5e, 0x4e, 0xab, 0xa5, 0x0c, 0x9a, 0x4d, 0x9f,
+	0x46, 0x51, 0x21, 0xcb, 0xd6, 0x0d, 0x51, 0x45, 0xc1, 0x39, 0xd6, 0xcd, 0x5c, 0xfc, 0x04, 0xdd,
+	0xc1, 0x28, 0x0e, 0x23, 0xc9, 0x77, 0xb7, 0xa4, 0xdf, 0x5f, 0xb5, 0xdf, 0xf9, 0x99, 0x2e, 0x17,
+	0xe9, 0xb1, 0xe0, 0x0a, 0xd1, 0x64, 0x86, 0x45, 0x1c, 0xcb, 0x88, 0x9f, 0xa2, 0x5b, 0xd1, 0x5f,
+	0x1b, 0xf9, 0x70, 0x04, 0x17, 0x67, 0xb3, 0x05, 0xb1, 0xf9, 0x82, 0xd8, 0x6a, 0x41, 0xf0, 0xa2,
+	0x09, 0xde, 0x34, 0xc1, 0xbb, 0x26, 0x98, 0x69, 0x82, 0x0f, 0x4d, 0xf0, 0xa9, 0x89, 0xad, 0x34,
+	0xc1, 0xeb, 0x92, 0xd8, 0x6c, 0x49, 0x6c, 0xbe, 0x24, 0x76, 0xb3, 0x39, 0xf0, 0xd8, 0xb5, 0x17,
+	0x3f, 0xfe, 0x1a, 0x00, 0xb4, 0x77, 0xc4, 0xf6, 0x0c, 0x02, 0x00, 0x00,
 }
 
 func (this *HTTPRequest) Equal(that interface{}) bool {
@@ -471,6 +472,110 @@ var _HTTP_serviceDesc = grpc.ServiceDesc{
 	Metadata: "httpgrpc/httpgrpc.proto",
 }
 
+// HTTPTunnelClient is the client API for HTTPTunnel service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type HTTPTunnelClient interface {
+	Tunnel(ctx context.Context, opts ...grpc.CallOption) (HTTPTunnel_TunnelClient, error)
+}
+
+type hTTPTunnelClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewHTTPTunnelClient(cc *grpc.ClientConn) HTTPTunnelClient {
+	return &hTTPTunnelClient{cc}
+}
+
+func (c *hTTPTunnelClient) Tunnel(ctx context.Context, opts ...grpc.CallOption) (HTTPTunnel_TunnelClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_HTTPTunnel_serviceDesc.Streams[0], "/httpgrpc.HTTPTunnel/Tunnel", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &hTTPTunnelTunnelClient{stream}
+	return x, nil
+}
+
+type HTTPTunnel_TunnelClient interface {
+	Send(*HTTPRequest) error
+	Recv() (*HTTPResponse, error)
+	grpc.ClientStream
+}
+
+type hTTPTunnelTunnelClient struct {
+	grpc.ClientStream
+}
+
+func (x *hTTPTunnelTunnelClient) Send(m *HTTPRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *hTTPTunnelTunnelClient) Recv() (*HTTPResponse, error) {
+	m := new(HTTPResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// HTTPTunnelServer is the server API for HTTPTunnel service.
+type HTTPTunnelServer interface {
+	Tunnel(HTTPTunnel_TunnelServer) error
+}
+
+// UnimplementedHTTPTunnelServer can be embedded to have forward compatible implementations.
+type UnimplementedHTTPTunnelServer struct {
+}
+
+func (*UnimplementedHTTPTunnelServer) Tunnel(srv HTTPTunnel_TunnelServer) error {
+	return status.Errorf(codes.Unimplemented, "method Tunnel not implemented")
+}
+
+func RegisterHTTPTunnelServer(s *grpc.Server, srv HTTPTunnelServer) {
+	s.RegisterService(&_HTTPTunnel_serviceDesc, srv)
+}
+
+func _HTTPTunnel_Tunnel_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(HTTPTunnelServer).Tunnel(&hTTPTunnelTunnelServer{stream})
+}
+
+type HTTPTunnel_TunnelServer interface {
+	Send(*HTTPResponse) error
+	Recv() (*HTTPRequest, error)
+	grpc.ServerStream
+}
+
+type hTTPTunnelTunnelServer struct {
+	grpc.ServerStream
+}
+
+func (x *hTTPTunnelTunnelServer) Send(m *HTTPResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *hTTPTunnelTunnelServer) Recv() (*HTTPRequest, error) {
+	m := new(HTTPRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _HTTPTunnel_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "httpgrpc.HTTPTunnel",
+	HandlerType: (*HTTPTunnelServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Tunnel",
+			Handler:       _HTTPTunnel_Tunnel_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "httpgrpc/httpgrpc.proto",
+}
+
 func (m *HTTPRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -0,0 +1,152 @@
+// Package router forwards HTTP requests to one of several httpgrpc backends,
+// chosen by path prefix, host or headers, so that a gateway can be built out
+// of httpgrpc Clients.
+package router
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/videocoin/common/instrument"
+	"github.com/videocoin/common/instrument/registry"
+	"github.com/videocoin/common/middleware"
+)
+
+// Backend is one destination of a Route.
+type Backend struct {
+	// Name is used as the backend label of the metrics.
+	Name string
+	// Handler is usually an httpgrpc server.Client.
+	Handler http.Handler
+	// Weight is the share of the Route's traffic this backend gets, relative
+	// to the other backends of the Route.  Use this for canaries.
+	Weight int
+}
+
+// Route matches requests on all of its non-empty fields, and forwards them to
+// one of its Backends.
+type Route struct {
+	PathPrefix string
+	Host       string
+	Headers    map[string]string
+
+	// Rewrite optionally changes the request before it is forwarded, e.g.
+	// middleware.PathRewrite.
+	Rewrite middleware.Interface
+
+	Backends []Backend
+}
+
+func (r *Route) matches(req *http.Request) bool {
+	if r.PathPrefix != "" && !strings.HasPrefix(req.URL.Path, r.PathPrefix) {
+		return false
+	}
+	if r.Host != "" && !strings.EqualFold(stripPort(req.Host), r.Host) {
+		return false
+	}
+	for k, v := range r.Headers {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func stripPort(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	return host
+}
+
+type route struct {
+	Route
+	handler     http.Handler
+	handlers    []http.Handler
+	totalWeight int
+}
+
+// pick chooses a backend at random, in proportion to their weights.
+func (r *route) pick() http.Handler {
+	n := rand.Intn(r.totalWeight)
+	for i, b := range r.Backends {
+		if n < b.Weight {
+			return r.handlers[i]
+		}
+		n -= b.Weight
+	}
+	return r.handlers[len(r.handlers)-1]
+}
+
+// Router is a http.Handler which forwards each request to the first Route
+// that matches it, or responds 404 if none do.
+type Router struct {
+	routes []*route
+}
+
+// New makes a new Router.  Per-backend request metrics are registered with
+// reg, or the default Prometheus registry if reg is nil.
+func New(routes []Route, reg prometheus.Registerer) (*Router, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	// Shared by the routers registered with reg.
+	duration := registry.RegisterOrGet(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "httpgrpc_router_request_duration_seconds",
+		Help:    "Time (in seconds) spent serving HTTP requests forwarded to each backend.",
+		Buckets: instrument.DefBuckets,
+	}, []string{"backend", "method", "status_code"})).(*prometheus.HistogramVec)
+
+	router := &Router{}
+	for i, r := range routes {
+		if len(r.Backends) == 0 {
+			return nil, fmt.Errorf("route %d has no backends", i)
+		}
+		rt := &route{Route: r}
+		for _, b := range r.Backends {
+			if b.Weight < 0 {
+				return nil, fmt.Errorf("backend %q has negative weight", b.Name)
+			}
+			rt.totalWeight += b.Weight
+			rt.handlers = append(rt.handlers, instrumentBackend(duration, b))
+		}
+		if rt.totalWeight == 0 {
+			return nil, fmt.Errorf("route %d has no backend with a positive weight", i)
+		}
+
+		rt.handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rt.pick().ServeHTTP(w, req)
+		})
+		if r.Rewrite != nil {
+			rt.handler = r.Rewrite.Wrap(rt.handler)
+		}
+		router.routes = append(router.routes, rt)
+	}
+	return router, nil
+}
+
+func instrumentBackend(duration *prometheus.HistogramVec, b Backend) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := httpsnoop.CaptureMetrics(b.Handler, w, r)
+		instrument.ObserveWithExemplar(r.Context(), duration.WithLabelValues(b.Name, r.Method, strconv.Itoa(m.Code)), m.Duration.Seconds())
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	for _, rt := range r.routes {
+		if rt.matches(req) {
+			rt.handler.ServeHTTP(w, req)
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
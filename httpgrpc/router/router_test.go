@@ -0,0 +1,115 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/videocoin/common/middleware"
+)
+
+func named(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", name, r.RequestURI)
+	})
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRouter(t *testing.T) {
+	r, err := New([]Route{
+		{
+			Headers:  map[string]string{"X-Canary": "true"},
+			Backends: []Backend{{Name: "canary", Handler: named("canary"), Weight: 1}},
+		},
+		{
+			Host:       "api.example.com",
+			PathPrefix: "/v1/",
+			Rewrite:    middleware.PathRewrite(regexp.MustCompile("^/v1"), ""),
+			Backends:   []Backend{{Name: "api", Handler: named("api"), Weight: 1}},
+		},
+		{
+			PathPrefix: "/static/",
+			Backends:   []Backend{{Name: "static", Handler: named("static"), Weight: 1}},
+		},
+	}, prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		host, path string
+		headers    map[string]string
+		code       int
+		body       string
+	}{
+		{"api.example.com:80", "/v1/foo", nil, 200, "api /foo"},
+		{"other.example.com", "/v1/foo", nil, 404, "404 page not found\n"},
+		{"other.example.com", "/static/foo", nil, 200, "static /static/foo"},
+		{"other.example.com", "/v1/foo", map[string]string{"X-Canary": "true"}, 200, "canary /v1/foo"},
+	} {
+		req := httptest.NewRequest("GET", "http://"+tc.host+tc.path, nil)
+		req.RequestURI = tc.path
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		recorder := serve(r, req)
+		assert.Equal(t, tc.code, recorder.Code, tc.path)
+		assert.Equal(t, tc.body, recorder.Body.String(), tc.path)
+	}
+}
+
+func TestWeightedBackends(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	r, err := New([]Route{{
+		Backends: []Backend{
+			{Name: "stable", Handler: named("stable"), Weight: 9},
+			{Name: "canary", Handler: named("canary"), Weight: 1},
+			{Name: "drained", Handler: named("drained"), Weight: 0},
+		},
+	}}, reg)
+	require.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		serve(r, httptest.NewRequest("GET", "/", nil))
+	}
+
+	count, err := testutil.GatherAndCount(reg)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	counts := map[string]uint64{}
+	for _, m := range families[0].Metric {
+		counts[m.Label[0].GetValue()] = m.Histogram.GetSampleCount()
+	}
+	assert.InDelta(t, 900, counts["stable"], 60)
+	assert.InDelta(t, 100, counts["canary"], 60)
+	assert.Zero(t, counts["drained"])
+}
+
+func TestInvalidRoutes(t *testing.T) {
+	_, err := New([]Route{{}}, prometheus.NewPedanticRegistry())
+	assert.Error(t, err)
+
+	_, err = New([]Route{{Backends: []Backend{{Name: "a", Handler: named("a")}}}}, prometheus.NewPedanticRegistry())
+	assert.Error(t, err)
+}
+
+func TestRoutersShareRegistry(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	for i := 0; i < 2; i++ {
+		_, err := New([]Route{{Backends: []Backend{{Name: "a", Weight: 1, Handler: named("a")}}}}, reg)
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/balancer/roundrobin"
+
+	"github.com/videocoin/common/breaker"
+	"github.com/videocoin/common/consistenthash"
+	"github.com/videocoin/common/logging"
+)
+
+// ClientConfig for a Client.
+type ClientConfig struct {
+	Balancer       string         `yaml:"balancer"`
+	LoadFactor     float64        `yaml:"load_factor"`
+	Hedging        HedgingConfig  `yaml:"hedging"`
+	CircuitBreaker breaker.Config `yaml:"circuit_breaker"`
+
+	// If not set, default Prometheus registry is used.
+	Registerer prometheus.Registerer `yaml:"-"`
+	// If not set, the global logger, named "httpgrpc", is used.
+	Log logging.Interface `yaml:"-"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet.
+func (cfg *ClientConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.StringVar(&cfg.Balancer, prefix+"balancer", roundrobin.Name, "Load balancer to use: round_robin, consistent_hash, or any other registered with balancer.Register, e.g. by consistenthash.NewBuilder with a custom key.")
+	f.Float64Var(&cfg.LoadFactor, prefix+"balancer.load-factor", consistenthash.DefaultLoadFactor, "How far above the average load a backend may go before consistent_hash sends its keys elsewhere.")
+	cfg.Hedging.RegisterFlagsWithPrefix(prefix, f)
+	cfg.CircuitBreaker.RegisterFlagsWithPrefix(prefix, f)
+}
+
+// DefaultHedgingMethods are the idempotent HTTP methods hedged by default.
+var DefaultHedgingMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+// HedgingConfig configures request hedging for a Client.
+type HedgingConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Delay        time.Duration `yaml:"delay"`
+	MaxPerSecond float64       `yaml:"max_per_second"`
+	// Methods are hedged, as they are safe to send twice; DefaultHedgingMethods
+	// if empty.
+	Methods []string `yaml:"methods"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet.
+func (cfg *HedgingConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, prefix+"hedging.enabled", false, "Send a duplicate request when the first one is slow, and use whichever answers first.")
+	f.DurationVar(&cfg.Delay, prefix+"hedging.delay", 0, "How long to wait before sending a hedged request. 0 to use the observed p95 latency.")
+	f.Float64Var(&cfg.MaxPerSecond, prefix+"hedging.max-per-second", 10, "Maximum number of hedged requests sent per second, <=0 to disable the limit.")
+	f.Func(prefix+"hedging.methods", "Comma-separated HTTP methods which are hedged, as they are safe to send twice. (default GET,HEAD,OPTIONS)", func(s string) error {
+		cfg.Methods = nil
+		for _, m := range strings.Split(s, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				cfg.Methods = append(cfg.Methods, strings.ToUpper(m))
+			}
+		}
+		return nil
+	})
+}
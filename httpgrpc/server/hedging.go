@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+
+	"github.com/videocoin/common/httpgrpc"
+)
+
+const (
+	// Number of recent latencies used to compute the hedging delay, and how
+	// many we need before we trust the estimate.
+	latencyWindowSize       = 256
+	latencyWindowMinSamples = 20
+	hedgingQuantile         = 0.95
+)
+
+type handleFunc func(context.Context, *httpgrpc.HTTPRequest, ...grpc.CallOption) (*httpgrpc.HTTPResponse, error)
+
+// hedger sends a second copy of a request if the first one has not
+// returned after a delay, and returns whichever succeeds first.
+type hedger struct {
+	cfg       HedgingConfig
+	methods   map[string]bool
+	latencies *latencyWindow
+	limiter   *tokenBucket
+
+	hedges prometheus.Counter
+	wins   prometheus.Counter
+}
+
+func newHedger(cfg HedgingConfig, m *clientMetrics, target string) *hedger {
+	methods := map[string]bool{}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = DefaultHedgingMethods
+	}
+	for _, method := range cfg.Methods {
+		methods[strings.ToUpper(method)] = true
+	}
+	return &hedger{
+		cfg:       cfg,
+		methods:   methods,
+		latencies: newLatencyWindow(latencyWindowSize),
+		limiter:   newTokenBucket(cfg.MaxPerSecond),
+		hedges:    m.hedges.WithLabelValues(target),
+		wins:      m.hedgeWins.WithLabelValues(target),
+	}
+}
+
+// delay returns how long to wait before hedging, or false if we should not
+// hedge at all.
+func (h *hedger) delay() (time.Duration, bool) {
+	if h.cfg.Delay > 0 {
+		return h.cfg.Delay, true
+	}
+	return h.latencies.quantile(hedgingQuantile)
+}
+
+type hedgeResult struct {
+	resp  *httpgrpc.HTTPResponse
+	err   error
+	hedge bool
+}
+
+func (h *hedger) do(ctx context.Context, req *httpgrpc.HTTPRequest, handle handleFunc) (*httpgrpc.HTTPResponse, error) {
+	// Requests which are not idempotent could be acted on twice.
+	if !h.methods[req.Method] {
+		return handle(ctx, req)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancels the loser
+
+	// Buffered so the loser never blocks after we have returned.
+	results := make(chan hedgeResult, 2)
+	call := func(hedge bool) {
+		resp, err := handle(ctx, req)
+		results <- hedgeResult{resp: resp, err: err, hedge: hedge}
+	}
+
+	begin := time.Now()
+	go call(false)
+	inflight := 1
+
+	var timeout <-chan time.Time
+	if d, ok := h.delay(); ok {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case <-timeout:
+			timeout = nil
+			if !h.limiter.take(time.Now()) {
+				continue
+			}
+			h.hedges.Inc()
+			inflight++
+			go call(true)
+
+		case res := <-results:
+			inflight--
+			if res.err == nil {
+				// Only primary attempts tell us how long requests take
+				// without hedging.
+				if res.hedge {
+					h.wins.Inc()
+				} else {
+					h.latencies.observe(time.Since(begin))
+				}
+				return res.resp, nil
+			}
+			// Give the other request a chance to succeed.
+			if inflight > 0 {
+				continue
+			}
+			return res.resp, res.err
+		}
+	}
+}
+
+// latencyWindow keeps the most recent latencies in a ring buffer.
+type latencyWindow struct {
+	mtx     sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{
+		samples: make([]time.Duration, size),
+	}
+}
+
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.samples[w.next] = d
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+}
+
+// quantile returns the q-quantile of the recorded latencies, or false if
+// there are not enough samples yet.
+func (w *latencyWindow) quantile(q float64) (time.Duration, bool) {
+	w.mtx.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	if n < latencyWindowMinSamples {
+		w.mtx.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	w.mtx.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(q*float64(n-1))], true
+}
+
+// tokenBucket is a simple rate limiter; a rate <= 0 allows everything.
+type tokenBucket struct {
+	mtx    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := math.Max(rate, 1)
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/videocoin/common/user"
+)
+
+// slowFirstHandler blocks the first request until it is cancelled, and
+// answers every other request straight away.
+func slowFirstHandler(calls *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, "world")
+	})
+}
+
+func TestHedging(t *testing.T) {
+	var calls int32
+	server, err := newTestServer(slowFirstHandler(&calls))
+	require.NoError(t, err)
+	defer server.grpcServer.GracefulStop()
+
+	reg := prometheus.NewPedanticRegistry()
+	client, err := NewClientWithConfig(server.URL, ClientConfig{
+		Hedging: HedgingConfig{
+			Enabled: true,
+			Delay:   10 * time.Millisecond,
+		},
+		Registerer: reg,
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/hello", &bytes.Buffer{})
+	require.NoError(t, err)
+
+	req = req.WithContext(user.InjectOrgID(context.Background(), "1"))
+	recorder := httptest.NewRecorder()
+	client.ServeHTTP(recorder, req)
+
+	assert.Equal(t, "world", recorder.Body.String())
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, 1.0, testutil.ToFloat64(client.hedger.hedges))
+	assert.Equal(t, 1.0, testutil.ToFloat64(client.hedger.wins))
+
+	// Only the latencies of primary attempts are used for the hedging delay.
+	assert.Equal(t, 0, client.hedger.latencies.next)
+	recorder = httptest.NewRecorder()
+	client.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, 1, client.hedger.latencies.next)
+}
+
+func TestHedgingOnlyIdempotentMethods(t *testing.T) {
+	var calls int32
+	server, err := newTestServer(slowFirstHandler(&calls))
+	require.NoError(t, err)
+	defer server.grpcServer.GracefulStop()
+
+	client, err := NewClientWithConfig(server.URL, ClientConfig{
+		Hedging: HedgingConfig{
+			Enabled: true,
+			Delay:   10 * time.Millisecond,
+		},
+		Registerer: prometheus.NewPedanticRegistry(),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(user.InjectOrgID(context.Background(), "1"), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequest("POST", "/hello", &bytes.Buffer{})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	client.ServeHTTP(recorder, req.WithContext(ctx))
+
+	assert.Equal(t, 500, recorder.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, 0.0, testutil.ToFloat64(client.hedger.hedges))
+}
+
+func TestHedgingRateLimited(t *testing.T) {
+	var calls int32
+	server, err := newTestServer(slowFirstHandler(&calls))
+	require.NoError(t, err)
+	defer server.grpcServer.GracefulStop()
+
+	client, err := NewClientWithConfig(server.URL, ClientConfig{
+		Hedging: HedgingConfig{
+			Enabled:      true,
+			Delay:        10 * time.Millisecond,
+			MaxPerSecond: 1,
+		},
+		Registerer: prometheus.NewPedanticRegistry(),
+	})
+	require.NoError(t, err)
+
+	// Use up the only token, so the request below cannot be hedged.
+	require.True(t, client.hedger.limiter.take(time.Now()))
+
+	ctx, cancel := context.WithTimeout(user.InjectOrgID(context.Background(), "1"), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequest("GET", "/hello", &bytes.Buffer{})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	client.ServeHTTP(recorder, req.WithContext(ctx))
+
+	assert.Equal(t, 500, recorder.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, 0.0, testutil.ToFloat64(client.hedger.hedges))
+}
+
+func TestLatencyWindow(t *testing.T) {
+	w := newLatencyWindow(100)
+	_, ok := w.quantile(hedgingQuantile)
+	assert.False(t, ok)
+
+	for i := 1; i <= 200; i++ {
+		w.observe(time.Duration(i) * time.Millisecond)
+	}
+	d, ok := w.quantile(hedgingQuantile)
+	assert.True(t, ok)
+	assert.Equal(t, 195*time.Millisecond, d)
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(2)
+	assert.True(t, b.take(now))
+	assert.True(t, b.take(now))
+	assert.False(t, b.take(now))
+	assert.True(t, b.take(now.Add(500*time.Millisecond)))
+	assert.False(t, b.take(now.Add(500*time.Millisecond)))
+
+	unlimited := newTokenBucket(0)
+	for i := 0; i < 100; i++ {
+		assert.True(t, unlimited.take(now))
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/videocoin/common/instrument/registry"
+)
+
+// clientMetrics are shared by all Clients using the same Registerer, and
+// are labelled by target address.
+type clientMetrics struct {
+	hedges       *prometheus.CounterVec
+	hedgeWins    *prometheus.CounterVec
+	breakerState *prometheus.GaugeVec
+
+	tunnelDuration *prometheus.HistogramVec
+	tunnelBytes    *prometheus.CounterVec
+}
+
+func newClientMetrics(reg prometheus.Registerer) *clientMetrics {
+	return &clientMetrics{
+		hedges: registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "httpgrpc_client_hedged_requests_total",
+			Help: "Total number of hedged requests sent.",
+		}, []string{"target"})).(*prometheus.CounterVec),
+		hedgeWins: registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "httpgrpc_client_hedged_request_wins_total",
+			Help: "Total number of hedged requests which returned before the original request.",
+		}, []string{"target"})).(*prometheus.CounterVec),
+		breakerState: registry.RegisterOrGet(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "httpgrpc_client_circuit_breaker_state",
+			Help: "State of the circuit breaker (0 closed, 1 open, 2 half-open).",
+		}, []string{"target"})).(*prometheus.GaugeVec),
+		tunnelDuration: registry.RegisterOrGet(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "httpgrpc_client_tunnel_duration_seconds",
+			Help:    "Time (in seconds) upgraded connections stayed open.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		}, []string{"target"})).(*prometheus.HistogramVec),
+		tunnelBytes: registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "httpgrpc_client_tunnel_bytes_total",
+			Help: "Total number of bytes carried by upgraded connections, sent to or received from the target.",
+		}, []string{"target", "direction"})).(*prometheus.CounterVec),
+	}
+}
@@ -14,11 +14,15 @@ import (
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	otgrpc "github.com/opentracing-contrib/go-grpc"
 	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sercand/kuberesolver"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/roundrobin"
 
+	"github.com/videocoin/common/breaker"
+	"github.com/videocoin/common/consistenthash"
 	"github.com/videocoin/common/httpgrpc"
 	"github.com/videocoin/common/logging"
 	"github.com/videocoin/common/middleware"
@@ -48,14 +52,10 @@ func (n nopCloser) BytesBuffer() *bytes.Buffer { return n.Buffer }
 
 // Handle implements HTTPServer.
 func (s Server) Handle(ctx context.Context, r *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
-	req, err := http.NewRequest(r.Method, r.Url, nopCloser{Buffer: bytes.NewBuffer(r.Body)})
+	req, err := toHTTPRequest(ctx, r)
 	if err != nil {
 		return nil, err
 	}
-	toHeader(r.Headers, req.Header)
-	req = req.WithContext(ctx)
-	req.RequestURI = r.Url
-	req.ContentLength = int64(len(r.Body))
 
 	recorder := httptest.NewRecorder()
 	s.handler.ServeHTTP(recorder, req)
@@ -70,14 +70,31 @@ func (s Server) Handle(ctx context.Context, r *httpgrpc.HTTPRequest) (*httpgrpc.
 	return resp, nil
 }
 
+func toHTTPRequest(ctx context.Context, r *httpgrpc.HTTPRequest) (*http.Request, error) {
+	req, err := http.NewRequest(r.Method, r.Url, nopCloser{Buffer: bytes.NewBuffer(r.Body)})
+	if err != nil {
+		return nil, err
+	}
+	toHeader(r.Headers, req.Header)
+	req = req.WithContext(ctx)
+	req.RequestURI = r.Url
+	req.ContentLength = int64(len(r.Body))
+	return req, nil
+}
+
 // Client is a http.Handler that forwards the request over gRPC.
 type Client struct {
-	mtx       sync.RWMutex
-	service   string
-	namespace string
-	port      string
-	client    httpgrpc.HTTPClient
-	conn      *grpc.ClientConn
+	mtx          sync.RWMutex
+	service      string
+	namespace    string
+	port         string
+	client       httpgrpc.HTTPClient
+	tunnelClient httpgrpc.HTTPTunnelClient
+	conn         *grpc.ClientConn
+	hedger       *hedger
+	target       string
+	metrics      *clientMetrics
+	log          logging.Interface
 }
 
 // ParseURL deals with direct:// style URLs, as well as kubernetes:// urls.
@@ -126,20 +143,68 @@ func ParseURL(unparsed string) (string, error) {
 
 // NewClient makes a new Client, given a kubernetes service address.
 func NewClient(address string) (*Client, error) {
+	return NewClientWithConfig(address, ClientConfig{})
+}
+
+// NewClientWithConfig makes a new Client, given a kubernetes service address
+// and a ClientConfig.
+func NewClientWithConfig(address string, cfg ClientConfig) (*Client, error) {
 	kuberesolver.RegisterInCluster()
 
+	target := address
 	address, err := ParseURL(address)
 	if err != nil {
 		return nil, err
 	}
 
+	// If user doesn't supply a registerer, use Prometheus' by default.
+	reg := cfg.Registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	metrics := newClientMetrics(reg)
+	unaryInterceptors := []grpc.UnaryClientInterceptor{
+		otgrpc.OpenTracingClientInterceptor(opentracing.GlobalTracer()),
+		middleware.ClientUserHeaderInterceptor,
+	}
+	streamInterceptors := []grpc.StreamClientInterceptor{
+		otgrpc.OpenTracingStreamClientInterceptor(opentracing.GlobalTracer()),
+		middleware.StreamClientUserHeaderInterceptor,
+	}
+	if cfg.CircuitBreaker.Enabled {
+		// Last, so only errors from the target itself count against it.
+		// Tunnels share the breaker, but only failures to open them count.
+		b := breaker.New(cfg.CircuitBreaker, metrics.breakerState.WithLabelValues(target))
+		unaryInterceptors = append(unaryInterceptors, breaker.UnaryClientInterceptor(b, isServerFailure))
+		streamInterceptors = append(streamInterceptors, breaker.StreamClientInterceptor(b, isServerFailure))
+	}
+
 	dialOptions := []grpc.DialOption{
-		grpc.WithBalancerName(roundrobin.Name),
 		grpc.WithInsecure(),
-		grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
-			otgrpc.OpenTracingClientInterceptor(opentracing.GlobalTracer()),
-			middleware.ClientUserHeaderInterceptor,
-		)),
+		grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(unaryInterceptors...)),
+		grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(streamInterceptors...)),
+	}
+	switch cfg.Balancer {
+	case "", roundrobin.Name:
+		dialOptions = append(dialOptions, grpc.WithBalancerName(roundrobin.Name))
+	default:
+		// Any registered balancer may be used, e.g. a consistenthash builder
+		// with a custom KeyFunc.  Only consistenthash builders are given the
+		// load factor; others get an empty config.
+		b := balancer.Get(cfg.Balancer)
+		if b == nil {
+			return nil, fmt.Errorf("unrecognised balancer: %s", cfg.Balancer)
+		}
+		if consistenthash.IsBuilder(b) {
+			loadFactor := cfg.LoadFactor
+			if loadFactor == 0 {
+				loadFactor = consistenthash.DefaultLoadFactor
+			}
+			dialOptions = append(dialOptions, grpc.WithDefaultServiceConfig(consistenthash.ServiceConfig(cfg.Balancer, loadFactor)))
+		} else {
+			dialOptions = append(dialOptions, grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}]}`, cfg.Balancer)))
+		}
 	}
 
 	conn, err := grpc.Dial(address, dialOptions...)
@@ -147,10 +212,27 @@ func NewClient(address string) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{
-		client: httpgrpc.NewHTTPClient(conn),
-		conn:   conn,
-	}, nil
+	client := &Client{
+		client:       httpgrpc.NewHTTPClient(conn),
+		tunnelClient: httpgrpc.NewHTTPTunnelClient(conn),
+		conn:         conn,
+		target:       target,
+		metrics:      metrics,
+		log:          cfg.Log,
+	}
+	if cfg.Hedging.Enabled {
+		client.hedger = newHedger(cfg.Hedging, metrics, target)
+	}
+	return client, nil
+}
+
+// logger returns the configured logger, or else the current global one, so
+// that a global logger set after the Client was made is used.
+func (c *Client) logger() logging.Interface {
+	if c.log != nil {
+		return c.log
+	}
+	return logging.Named(logging.Global(), "httpgrpc")
 }
 
 // HTTPRequest wraps an ordinary HTTPRequest with a gRPC one
@@ -190,24 +272,32 @@ func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if tracer := opentracing.GlobalTracer(); tracer != nil {
 		if span := opentracing.SpanFromContext(r.Context()); span != nil {
 			if err := tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header)); err != nil {
-				logging.Global().Warnf("Failed to inject tracing headers into request: %v", err)
+				c.logger().Warnf("Failed to inject tracing headers into request: %v", err)
 			}
 		}
 	}
 
+	if isUpgradeRequest(r) {
+		c.tunnel(w, r)
+		return
+	}
+
 	req, err := HTTPRequest(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	resp, err := c.client.Handle(r.Context(), req)
+	c.forward(w, r, req)
+}
+
+// forward req to the target's Handle, and write its response to w.
+func (c *Client) forward(w http.ResponseWriter, r *http.Request, req *httpgrpc.HTTPRequest) {
+	resp, err := c.handle(r.Context(), req)
 	if err != nil {
 		// Some errors will actually contain a valid resp, just need to unpack it
 		var ok bool
-		resp, ok = httpgrpc.HTTPResponseFromError(err)
-
-		if !ok {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if resp, ok = httpgrpc.HTTPResponseFromError(err); !ok {
+			writeClientError(w, err)
 			return
 		}
 	}
@@ -218,6 +308,32 @@ func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writeClientError reports an error which did not come from the target's
+// handler.
+func writeClientError(w http.ResponseWriter, err error) {
+	if breaker.IsOpen(err) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func (c *Client) handle(ctx context.Context, req *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+	if c.hedger != nil {
+		return c.hedger.do(ctx, req, c.client.Handle)
+	}
+	return c.client.Handle(ctx, req)
+}
+
+// isServerFailure counts 5xx responses, as well as gRPC errors from the
+// target, against the circuit breaker.
+func isServerFailure(err error) bool {
+	if resp, ok := httpgrpc.HTTPResponseFromError(err); ok {
+		return resp.Code/100 == 5
+	}
+	return breaker.IsServerFailure(err)
+}
+
 func toHeader(hs []*httpgrpc.Header, header http.Header) {
 	for _, h := range hs {
 		header[h.Key] = h.Values
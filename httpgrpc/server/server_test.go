@@ -1,21 +1,33 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	jaegercfg "github.com/uber/jaeger-client-go/config"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/serviceconfig"
 
+	"github.com/videocoin/common/breaker"
+	"github.com/videocoin/common/consistenthash"
 	"github.com/videocoin/common/httpgrpc"
 	"github.com/videocoin/common/middleware"
 	"github.com/videocoin/common/user"
@@ -40,6 +52,7 @@ func newTestServer(handler http.Handler) (*testServer, error) {
 	}
 
 	httpgrpc.RegisterHTTPServer(server.grpcServer, server.Server)
+	httpgrpc.RegisterHTTPTunnelServer(server.grpcServer, server.Server)
 	go server.grpcServer.Serve(lis)
 
 	return server, nil
@@ -142,3 +155,241 @@ func TestTracePropagation(t *testing.T) {
 	assert.Equal(t, "world", string(recorder.Body.Bytes()))
 	assert.Equal(t, 200, recorder.Code)
 }
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int32
+	server, err := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "foo", http.StatusInternalServerError)
+	}))
+	require.NoError(t, err)
+	defer server.grpcServer.GracefulStop()
+
+	client, err := NewClientWithConfig(server.URL, ClientConfig{
+		CircuitBreaker: breaker.Config{
+			Enabled:      true,
+			FailureRatio: 0.5,
+			MinRequests:  2,
+			Window:       time.Minute,
+			CoolDown:     time.Minute,
+		},
+		Registerer: prometheus.NewPedanticRegistry(),
+	})
+	require.NoError(t, err)
+
+	for _, expected := range []int{500, 500, 503, 503} {
+		req, err := http.NewRequest("GET", "/hello", &bytes.Buffer{})
+		require.NoError(t, err)
+
+		req = req.WithContext(user.InjectOrgID(context.Background(), "1"))
+		recorder := httptest.NewRecorder()
+		client.ServeHTTP(recorder, req)
+		assert.Equal(t, expected, recorder.Code)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	server, err := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "world")
+	}))
+	require.NoError(t, err)
+	defer server.grpcServer.GracefulStop()
+
+	client, err := NewClientWithConfig(server.URL, ClientConfig{
+		Balancer:   consistenthash.Name,
+		Registerer: prometheus.NewPedanticRegistry(),
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/hello", &bytes.Buffer{})
+	require.NoError(t, err)
+
+	req = req.WithContext(user.InjectOrgID(context.Background(), "1"))
+	recorder := httptest.NewRecorder()
+	client.ServeHTTP(recorder, req)
+
+	assert.Equal(t, "world", recorder.Body.String())
+	assert.Equal(t, 200, recorder.Code)
+
+	_, err = NewClientWithConfig(server.URL, ClientConfig{Balancer: "monster"})
+	assert.EqualError(t, err, "unrecognised balancer: monster")
+}
+
+func TestCustomKeyBalancer(t *testing.T) {
+	server, err := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "world")
+	}))
+	require.NoError(t, err)
+	defer server.grpcServer.GracefulStop()
+
+	var keyed int32
+	balancer.Register(consistenthash.NewBuilder("test_hash_by_user", func(ctx context.Context) (string, bool) {
+		atomic.AddInt32(&keyed, 1)
+		userID, err := user.ExtractUserID(ctx)
+		return userID, err == nil
+	}))
+	client, err := NewClientWithConfig(server.URL, ClientConfig{
+		Balancer:   "test_hash_by_user",
+		LoadFactor: 2,
+		Registerer: prometheus.NewPedanticRegistry(),
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/hello", &bytes.Buffer{})
+	require.NoError(t, err)
+
+	ctx := user.InjectUserID(user.InjectOrgID(context.Background(), "1"), "jane")
+	recorder := httptest.NewRecorder()
+	client.ServeHTTP(recorder, req.WithContext(ctx))
+
+	assert.Equal(t, "world", recorder.Body.String())
+	assert.Equal(t, 200, recorder.Code)
+	assert.NotZero(t, atomic.LoadInt32(&keyed))
+}
+
+// strictConfigBuilder is a round robin balancer which only accepts an empty
+// config.
+type strictConfigBuilder struct {
+	balancer.Builder
+}
+
+type strictConfig struct {
+	serviceconfig.LoadBalancingConfig
+}
+
+func (strictConfigBuilder) Name() string {
+	return "test_strict_config"
+}
+
+func (strictConfigBuilder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	if string(js) != "{}" {
+		return nil, fmt.Errorf("unexpected config %s", js)
+	}
+	return strictConfig{}, nil
+}
+
+func TestConfigParserBalancer(t *testing.T) {
+	server, err := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "world")
+	}))
+	require.NoError(t, err)
+	defer server.grpcServer.GracefulStop()
+
+	// Balancers other than consistenthash ones are not given a load factor.
+	balancer.Register(strictConfigBuilder{balancer.Get(roundrobin.Name)})
+	client, err := NewClientWithConfig(server.URL, ClientConfig{
+		Balancer:   "test_strict_config",
+		Registerer: prometheus.NewPedanticRegistry(),
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/hello", &bytes.Buffer{})
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	client.ServeHTTP(recorder, req.WithContext(user.InjectOrgID(context.Background(), "1")))
+	assert.Equal(t, "world", recorder.Body.String())
+	assert.Equal(t, 200, recorder.Code)
+}
+
+func TestTunnelWithoutTunnelService(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := grpc.NewServer()
+	defer grpcServer.GracefulStop()
+	// Only HTTP is implemented, as by targets predating HTTPTunnel.
+	httpgrpc.RegisterHTTPServer(grpcServer, NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "upgrade to %s ignored", r.Header.Get("Upgrade"))
+	})))
+	go grpcServer.Serve(lis)
+
+	client, err := NewClientWithConfig("direct://"+lis.Addr().String(), ClientConfig{Registerer: prometheus.NewRegistry()})
+	require.NoError(t, err)
+	front := httptest.NewServer(middleware.AuthenticateUser.Wrap(client))
+	defer front.Close()
+
+	req, err := http.NewRequest("GET", front.URL+"/feed", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Scope-OrgID", "1")
+	req.Header.Set("Upgrade", "h2c")
+	req.Header.Set("Connection", "Upgrade")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "upgrade to h2c ignored", string(body))
+}
+
+func TestTunnel(t *testing.T) {
+	server, err := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocol := r.Header.Get("Upgrade")
+		if protocol != "echo" && protocol != "read-first" {
+			http.Error(w, "unsupported protocol", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var first string
+		if protocol == "read-first" {
+			// Read from the client before writing anything.
+			if first, err = rw.ReadString('\n'); err != nil {
+				return
+			}
+		}
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n%s", protocol, first)
+		rw.Flush()
+		io.Copy(conn, rw)
+	}))
+	require.NoError(t, err)
+	defer server.grpcServer.GracefulStop()
+
+	client, err := NewClientWithConfig(server.URL, ClientConfig{Registerer: prometheus.NewRegistry()})
+	require.NoError(t, err)
+	front := httptest.NewServer(middleware.AuthenticateUser.Wrap(client))
+	defer front.Close()
+
+	for _, tc := range []struct {
+		protocol string
+		code     int
+	}{
+		{"echo", http.StatusSwitchingProtocols},
+		{"read-first", http.StatusSwitchingProtocols},
+		{"other", http.StatusBadRequest},
+	} {
+		t.Run(tc.protocol, func(t *testing.T) {
+			conn, err := net.Dial("tcp", front.Listener.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			fmt.Fprintf(conn, "GET /feed HTTP/1.1\r\nHost: test\r\nX-Scope-OrgID: 1\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n", tc.protocol)
+			if tc.protocol == "read-first" {
+				fmt.Fprint(conn, "first\n")
+			}
+			r := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(r, nil)
+			require.NoError(t, err)
+			require.Equal(t, tc.code, resp.StatusCode)
+			if tc.code != http.StatusSwitchingProtocols {
+				return
+			}
+			if tc.protocol == "read-first" {
+				line, err := r.ReadString('\n')
+				require.NoError(t, err)
+				assert.Equal(t, "first\n", line)
+			}
+
+			for _, msg := range []string{"hello\n", "world\n"} {
+				_, err = fmt.Fprint(conn, msg)
+				require.NoError(t, err)
+				line, err := r.ReadString('\n')
+				require.NoError(t, err)
+				assert.Equal(t, msg, line)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/videocoin/common/httpgrpc"
+)
+
+// tunnelBufferSize is the most bytes carried by a single Tunnel message.
+const tunnelBufferSize = 32 * 1024
+
+// isUpgradeRequest returns true for requests which ask to switch protocol,
+// e.g. WebSocket handshakes.
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, part := range strings.Split(r.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(part), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// Tunnel implements HTTPTunnelServer.  The first message is served like any other
+// request, except that the handler may hijack the connection; if it does, a
+// message with a zero code is sent back, and the bytes it reads and writes
+// are carried by the following messages.  Otherwise, its response is sent
+// back as a single message.
+func (s Server) Tunnel(stream httpgrpc.HTTPTunnel_TunnelServer) error {
+	r, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	req, err := toHTTPRequest(stream.Context(), r)
+	if err != nil {
+		return err
+	}
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	w := &hijackableRecorder{
+		ResponseRecorder: httptest.NewRecorder(),
+		conn:             remote,
+		hijacked:         make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handler.ServeHTTP(w, req)
+	}()
+
+	select {
+	case <-w.hijacked:
+	case <-done:
+		select {
+		case <-w.hijacked:
+		default:
+			remote.Close()
+			return stream.Send(&httpgrpc.HTTPResponse{
+				Code:    int32(w.Code),
+				Headers: fromHeader(w.Header()),
+				Body:    w.Body.Bytes(),
+			})
+		}
+	}
+
+	// Tell the client the connection was hijacked, so that it starts sending
+	// its bytes even if the handler reads before it writes.
+	if err := stream.Send(&httpgrpc.HTTPResponse{Code: 0}); err != nil {
+		return err
+	}
+
+	go func() {
+		// Closing local unblocks the read below, as well as the handler.
+		defer local.Close()
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if _, err := local.Write(msg.Body); err != nil {
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, tunnelBufferSize)
+	for {
+		n, err := local.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&httpgrpc.HTTPResponse{Body: append([]byte(nil), buf[:n]...)}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrClosedPipe {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// hijackableRecorder records the response of handlers which do not hijack
+// the connection, and hands one end of a pipe to those which do.
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	conn     net.Conn
+	hijacked chan struct{}
+}
+
+// Hijack implements http.Hijacker.
+func (h *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h.conn == nil {
+		return nil, nil, http.ErrHijacked
+	}
+	conn := h.conn
+	h.conn = nil
+	close(h.hijacked)
+	return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+}
+
+// tunnel forwards an upgrade request to the target, and if the target
+// switches protocol, carries the hijacked connection until either side
+// closes it.  If the target does not implement HTTPTunnel, the request is
+// forwarded to its Handle instead.
+func (c *Client) tunnel(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return
+	}
+
+	req, err := HTTPRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stream, err := c.tunnelClient.Tunnel(ctx)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	// If the target ended the stream, Recv returns its status.
+	if err := stream.Send(req); err != nil && err != io.EOF {
+		writeClientError(w, err)
+		return
+	}
+	resp, err := stream.Recv()
+	if status.Code(err) == codes.Unimplemented {
+		// Targets which only implement HTTP handle upgrade requests like
+		// any other.
+		cancel()
+		c.forward(w, r, req)
+		return
+	} else if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	if resp.Code != 0 {
+		// The target did not switch protocol.
+		if err := WriteResponse(w, resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	begin := time.Now()
+	sent := c.metrics.tunnelBytes.WithLabelValues(c.target, "sent")
+	received := c.metrics.tunnelBytes.WithLabelValues(c.target, "received")
+	defer func() {
+		c.metrics.tunnelDuration.WithLabelValues(c.target).Observe(time.Since(begin).Seconds())
+	}()
+
+	go func() {
+		defer stream.CloseSend()
+		buf := make([]byte, tunnelBufferSize)
+		for {
+			n, err := rw.Read(buf)
+			if n > 0 {
+				if err := stream.Send(&httpgrpc.HTTPRequest{Body: append([]byte(nil), buf[:n]...)}); err != nil {
+					return
+				}
+				sent.Add(float64(n))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// The first message only says the connection was hijacked, but servers
+	// which do not send one start with the handler's bytes.
+	for {
+		if len(resp.Body) > 0 {
+			if _, err := conn.Write(resp.Body); err != nil {
+				return
+			}
+			received.Add(float64(len(resp.Body)))
+		}
+		if resp, err = stream.Recv(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Package registry helps register Prometheus collectors shared between
+// instances, e.g. of loggers or clients.  It only depends on Prometheus, so
+// that any package, including logging, can use it.
+package registry
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// RegisterOrGet registers c with reg, or returns the existing collector if an
+// identical one has already been registered.  It panics on any other error,
+// like prometheus.MustRegister.
+func RegisterOrGet(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,24 @@
+package registry_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/videocoin/common/instrument/registry"
+)
+
+func TestRegisterOrGet(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	newCounter := func(help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: help}, []string{"name"})
+	}
+
+	first := newCounter("Test.")
+	assert.Equal(t, first, registry.RegisterOrGet(reg, first))
+	assert.Equal(t, first, registry.RegisterOrGet(reg, newCounter("Test.")))
+
+	// Collectors which clash with a different one still panic.
+	assert.Panics(t, func() { registry.RegisterOrGet(reg, newCounter("Different.")) })
+}
@@ -0,0 +1,22 @@
+package logging
+
+import "context"
+
+type contextKey int
+
+const interfaceKey contextKey = 0
+
+// WithContext returns a copy of ctx carrying log, typically a logger with
+// fields describing the request being served.
+func WithContext(ctx context.Context, log Interface) context.Context {
+	return context.WithValue(ctx, interfaceKey, log)
+}
+
+// FromContext returns the logger carried by ctx, or the global logger if it
+// carries none.
+func FromContext(ctx context.Context) Interface {
+	if log, ok := ctx.Value(interfaceKey).(Interface); ok {
+		return log
+	}
+	return Global()
+}
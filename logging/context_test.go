@@ -0,0 +1,17 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, Global(), FromContext(context.Background()))
+
+	logger, _ := test.NewNullLogger()
+	log := Logrus(logger).WithField("a", 1)
+	assert.Equal(t, log, FromContext(WithContext(context.Background(), log)))
+}
@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+const (
+	// ErrorKey is the field WithError logs errors as.
+	ErrorKey = "err"
+	// StacktraceKey is the field WithError logs the stack traces of errors as.
+	StacktraceKey = "stacktrace"
+)
+
+// exit is replaced in tests.
+var exit = os.Exit
+
+type stackTracer interface {
+	StackTrace() pkgerrors.StackTrace
+}
+
+type causer interface {
+	Cause() error
+}
+
+// Stacktrace returns the stack trace recorded by pkg/errors in err or the
+// errors it wraps, if any.  The innermost stack trace is returned, as it is
+// closest to where the error occurred.
+func Stacktrace(err error) (string, bool) {
+	var trace pkgerrors.StackTrace
+	for err != nil {
+		if st, ok := err.(stackTracer); ok {
+			trace = st.StackTrace()
+		}
+		if next := errors.Unwrap(err); next != nil {
+			err = next
+		} else if c, ok := err.(causer); ok {
+			err = c.Cause()
+		} else {
+			break
+		}
+	}
+	if trace == nil {
+		return "", false
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%+v", trace), "\n"), true
+}
+
+// ErrorFields returns the fields WithError adds for err: the error, and its
+// stack trace if it has one.
+func ErrorFields(err error) Fields {
+	fields := Fields{ErrorKey: err}
+	if trace, ok := Stacktrace(err); ok {
+		fields[StacktraceKey] = trace
+	}
+	return fields
+}
+
+// WithError returns a logger logging err, and its stack trace if it has one,
+// as fields.  Loggers with a WithError method of their own are delegated to.
+func WithError(log Interface, err error) Interface {
+	if l, ok := log.(interface{ WithError(error) Interface }); ok {
+		return l.WithError(err)
+	}
+	return log.WithFields(ErrorFields(err))
+}
+
+// Flush writes out entries buffered by log, if it has a Flush method.
+func Flush(log Interface) error {
+	if l, ok := log.(interface{ Flush() error }); ok {
+		return l.Flush()
+	}
+	return nil
+}
+
+type fataler interface {
+	Fatalf(format string, args ...interface{})
+	Fatalln(args ...interface{})
+}
+
+type panicker interface {
+	Panicf(format string, args ...interface{})
+	Panicln(args ...interface{})
+}
+
+// Fatalf logs a message at fatal level, flushes log and exits with status 1.
+// Loggers without fatal level log at error level instead.
+func Fatalf(log Interface, format string, args ...interface{}) {
+	if l, ok := log.(fataler); ok {
+		l.Fatalf(format, args...)
+		return
+	}
+	log.Errorf(format, args...)
+	_ = Flush(log)
+	exit(1)
+}
+
+// Fatalln logs a message at fatal level, flushes log and exits with status 1.
+// Loggers without fatal level log at error level instead.
+func Fatalln(log Interface, args ...interface{}) {
+	if l, ok := log.(fataler); ok {
+		l.Fatalln(args...)
+		return
+	}
+	log.Errorln(args...)
+	_ = Flush(log)
+	exit(1)
+}
+
+// Panicf logs a message at panic level, flushes log and panics with the
+// message.  Loggers without panic level log at error level instead.
+func Panicf(log Interface, format string, args ...interface{}) {
+	if l, ok := log.(panicker); ok {
+		l.Panicf(format, args...)
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	log.Errorln(msg)
+	_ = Flush(log)
+	panic(msg)
+}
+
+// Panicln logs a message at panic level, flushes log and panics with the
+// message.  Loggers without panic level log at error level instead.
+func Panicln(log Interface, args ...interface{}) {
+	if l, ok := log.(panicker); ok {
+		l.Panicln(args...)
+		return
+	}
+	msg := sprintln(args...)
+	log.Errorln(msg)
+	_ = Flush(log)
+	panic(msg)
+}
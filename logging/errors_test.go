@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStacktrace(t *testing.T) {
+	_, ok := Stacktrace(fmt.Errorf("plain: %w", fmt.Errorf("cause")))
+	assert.False(t, ok)
+
+	// The innermost stack trace is found through pkg/errors and fmt wrapping.
+	err := fmt.Errorf("handling: %w", pkgerrors.Wrap(pkgerrors.New("failed"), "calling"))
+	trace, ok := Stacktrace(err)
+	require.True(t, ok)
+	assert.Contains(t, trace, "logging.TestStacktrace")
+	assert.Contains(t, trace, "errors_test.go:20")
+
+	fields := ErrorFields(err)
+	assert.Equal(t, err, fields[ErrorKey])
+	assert.Equal(t, trace, fields[StacktraceKey])
+	plain := fmt.Errorf("plain")
+	assert.Equal(t, Fields{ErrorKey: plain}, ErrorFields(plain))
+}
+
+func TestWithError(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	err := pkgerrors.New("failed")
+
+	for _, log := range []Interface{
+		Logrus(logger),
+		Logrus(logger).WithField("a", 1),
+		NewLeveled(Logrus(logger), mustLevel("info"), nil),
+	} {
+		WithError(log, err).Errorln("request")
+		entry := hook.LastEntry()
+		assert.Equal(t, err, entry.Data[ErrorKey])
+		assert.Contains(t, entry.Data[StacktraceKey], "logging.TestWithError")
+	}
+	WithError(Noop(), err).Errorln("request")
+}
+
+func TestFatal(t *testing.T) {
+	var exitCode int
+	defer func(saved func(int)) { exit = saved }(exit)
+	exit = func(code int) { exitCode = code }
+
+	buf := &flushBuffer{}
+	logger := logrus.New()
+	logger.Out = buf
+	logger.ExitFunc = exit
+	log := NewLeveled(Logrus(logger), mustLevel("info"), nil)
+
+	Fatalf(log, "bad %s", "config")
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, buf.String(), "level=fatal")
+	assert.Contains(t, buf.String(), `msg="bad config"`)
+	assert.True(t, buf.flushed)
+
+	// Loggers without fatal level log at error level.
+	exitCode = 0
+	logger.Out = &bytes.Buffer{}
+	Fatalln(slogLogger{handler: NewSlogHandler(Logrus(logger))}, "bad")
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, logger.Out.(*bytes.Buffer).String(), "level=error")
+
+	exitCode = 0
+	Fatalln(Noop(), "bad")
+	assert.Equal(t, 1, exitCode)
+}
+
+func TestPanic(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	assert.Panics(t, func() { Panicf(Logrus(logger).WithField("a", 1), "bad %s", "state") })
+	assert.Equal(t, logrus.PanicLevel, hook.LastEntry().Level)
+	assert.Equal(t, "bad state", hook.LastEntry().Message)
+
+	assert.PanicsWithValue(t, "bad state", func() { Panicln(NewRedacting(Noop(), nil), "bad", "state") })
+}
+
+type flushBuffer struct {
+	bytes.Buffer
+	flushed bool
+}
+
+func (b *flushBuffer) Sync() error {
+	b.flushed = true
+	return nil
+}
@@ -11,12 +11,24 @@ import (
 type Format struct {
 	s      string
 	Logrus logrus.Formatter
+
+	// TimestampFormat is the Go time layout of timestamps.  It defaults to
+	// RFC3339 with nanoseconds, or the time of day for the console format.
+	TimestampFormat string
+	// Caller adds the file:line of log calls to entries.
+	Caller bool
+	// NoColor disables the colours of the console format, which are only
+	// used when writing to a terminal.
+	NoColor bool
 }
 
-// RegisterFlags adds the log format flag to the provided flagset.
+// RegisterFlags adds the log format flags to the provided flagset.
 func (f *Format) RegisterFlags(fs *flag.FlagSet) {
-	f.Set("logfmt")
-	fs.Var(f, "log.format", "Output log messages in the given format. Valid formats: [logfmt, json]")
+	f.Set(FormatLogfmt)
+	fs.Var(f, "log.format", "Output log messages in the given format. Valid formats: [logfmt, json, console]")
+	fs.StringVar(&f.TimestampFormat, "log.timestamp-format", "", "Go time layout of log timestamps. Defaults to RFC3339 with nanoseconds, or the time of day for the console format.")
+	fs.BoolVar(&f.Caller, "log.caller", false, "Add the file:line of log calls to log messages.")
+	fs.BoolVar(&f.NoColor, "log.no-color", false, "Disable the colours of the console format, which are only used when logging to a terminal.")
 }
 
 func (f Format) String() string {
@@ -40,13 +52,30 @@ func (f Format) MarshalYAML() (interface{}, error) {
 // Set updates the value of the output format.  Implements flag.Value
 func (f *Format) Set(s string) error {
 	switch s {
-	case "logfmt":
-		f.Logrus = &logrus.JSONFormatter{}
-	case "json":
-		f.Logrus = &logrus.JSONFormatter{}
+	case FormatLogfmt, FormatJSON, FormatConsole:
+		f.Logrus = &formatter{format: s}
 	default:
 		return errors.Errorf("unrecognized log format %q", s)
 	}
 	f.s = s
 	return nil
 }
+
+// formatter returns the logrus formatter of f, with its current options.
+// Formatters set by the caller are returned as they are.
+func (f Format) formatter() logrus.Formatter {
+	format := FormatLogfmt
+	switch l := f.Logrus.(type) {
+	case nil:
+	case *formatter:
+		format = l.format
+	default:
+		return f.Logrus
+	}
+	return &formatter{
+		format:          format,
+		timestampFormat: f.TimestampFormat,
+		caller:          f.Caller,
+		noColour:        f.NoColor,
+	}
+}
@@ -0,0 +1,272 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the output formats.
+const (
+	FormatLogfmt  = "logfmt"
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+const (
+	defaultTimestampFormat        = time.RFC3339Nano
+	defaultConsoleTimestampFormat = "15:04:05.000"
+)
+
+// loggingPackage is the import path of this package, whose frames are skipped
+// when looking for the caller.
+var loggingPackage = reflect.TypeOf(formatter{}).PkgPath()
+
+// formatter is a logrus.Formatter which writes the level, timestamp, caller
+// and message of entries first, followed by their fields sorted by key.
+type formatter struct {
+	format          string
+	timestampFormat string
+	caller          bool
+	noColour        bool
+
+	// colour is decided on the first console entry, from its output.
+	colourOnce sync.Once
+	colour     bool
+}
+
+// Format implements logrus.Formatter.
+func (f *formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	timestampFormat := f.timestampFormat
+	if timestampFormat == "" {
+		timestampFormat = defaultTimestampFormat
+		if f.format == FormatConsole {
+			timestampFormat = defaultConsoleTimestampFormat
+		}
+	}
+	caller := ""
+	if f.caller {
+		caller = findCaller()
+	}
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := entry.Buffer
+	if b == nil {
+		b = &bytes.Buffer{}
+	}
+	switch f.format {
+	case FormatJSON:
+		if err := f.writeJSON(b, entry, timestampFormat, caller, keys); err != nil {
+			return nil, err
+		}
+	case FormatConsole:
+		f.writeConsole(b, entry, timestampFormat, caller, keys)
+	default:
+		f.writeLogfmt(b, entry, timestampFormat, caller, keys)
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+func (f *formatter) writeLogfmt(b *bytes.Buffer, entry *logrus.Entry, timestampFormat, caller string, keys []string) {
+	writeLogfmtPair(b, "level", entry.Level.String())
+	writeLogfmtPair(b, "ts", entry.Time.Format(timestampFormat))
+	if caller != "" {
+		writeLogfmtPair(b, "caller", caller)
+	}
+	writeLogfmtPair(b, "msg", entry.Message)
+	for _, k := range keys {
+		writeLogfmtPair(b, k, entry.Data[k])
+	}
+}
+
+func writeLogfmtPair(b *bytes.Buffer, key string, value interface{}) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(key)
+	b.WriteByte('=')
+	writeLogfmtValue(b, value)
+}
+
+func writeLogfmtValue(b *bytes.Buffer, value interface{}) {
+	s := stringify(value)
+	if needsQuoting(s) {
+		b.WriteString(strconv.Quote(s))
+	} else {
+		b.WriteString(s)
+	}
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringify(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (f *formatter) writeJSON(b *bytes.Buffer, entry *logrus.Entry, timestampFormat, caller string, keys []string) error {
+	b.WriteByte('{')
+	first := true
+	write := func(key string, value interface{}) error {
+		if err, ok := value.(error); ok {
+			// Errors are usually structs without exported fields.
+			value = err.Error()
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal field %q to JSON: %v", key, err)
+		}
+		if !first {
+			b.WriteByte(',')
+		}
+		first = false
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+		return nil
+	}
+
+	if err := write("level", entry.Level.String()); err != nil {
+		return err
+	}
+	if err := write("ts", entry.Time.Format(timestampFormat)); err != nil {
+		return err
+	}
+	if caller != "" {
+		if err := write("caller", caller); err != nil {
+			return err
+		}
+	}
+	if err := write("msg", entry.Message); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := write(k, entry.Data[k]); err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+// ANSI colours of the console format.
+const (
+	colourReset = "\x1b[0m"
+	colourGrey  = "\x1b[90m"
+	colourRed   = "\x1b[31m"
+	colourGreen = "\x1b[32m"
+	colourYell  = "\x1b[33m"
+	colourBlue  = "\x1b[34m"
+	colourCyan  = "\x1b[36m"
+)
+
+func levelColour(level logrus.Level) string {
+	switch level {
+	case logrus.DebugLevel, logrus.TraceLevel:
+		return colourGrey
+	case logrus.InfoLevel:
+		return colourGreen
+	case logrus.WarnLevel:
+		return colourYell
+	default:
+		return colourRed
+	}
+}
+
+// isTerminal returns true if w is a terminal.
+var isTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (f *formatter) writeConsole(b *bytes.Buffer, entry *logrus.Entry, timestampFormat, caller string, keys []string) {
+	f.colourOnce.Do(func() {
+		f.colour = !f.noColour && entry.Logger != nil && isTerminal(entry.Logger.Out)
+	})
+	paint := func(colour, s string) string {
+		if !f.colour {
+			return s
+		}
+		return colour + s + colourReset
+	}
+
+	level := strings.ToUpper(entry.Level.String())
+	if len(level) > 4 {
+		level = level[:4]
+	}
+	fmt.Fprintf(b, "%s %s ", paint(levelColour(entry.Level), fmt.Sprintf("%-4s", level)),
+		paint(colourGrey, entry.Time.Format(timestampFormat)))
+	if caller != "" {
+		fmt.Fprintf(b, "%s ", paint(colourBlue, caller))
+	}
+	b.WriteString(entry.Message)
+	for _, k := range keys {
+		fmt.Fprintf(b, " %s", paint(colourCyan, k+"="))
+		writeLogfmtValue(b, entry.Data[k])
+	}
+}
+
+// findCaller returns the file:line of the first frame outside of logrus and
+// this package.
+func findCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isLoggingFrame(frame) {
+			return filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func isLoggingFrame(frame runtime.Frame) bool {
+	if frame.File == "<autogenerated>" || strings.HasPrefix(frame.Function, "github.com/sirupsen/logrus.") {
+		return true
+	}
+	return strings.HasPrefix(frame.Function, loggingPackage+".") && !strings.HasSuffix(frame.File, "_test.go")
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+func newTestLogger(t *testing.T, args ...string) (*logrus.Logger, *bytes.Buffer) {
+	var (
+		format Format
+		level  Level
+	)
+	fs := flag.NewFlagSet("", flag.PanicOnError)
+	format.RegisterFlags(fs)
+	level.RegisterFlags(fs)
+	require.NoError(t, fs.Parse(args))
+
+	buf := &bytes.Buffer{}
+	logger := NewLogrusFormat(level, format).(logrusLogger).Logger
+	logger.Out = buf
+	return logger, buf
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	logger, buf := newTestLogger(t)
+	logger.WithTime(testTime).WithFields(logrus.Fields{
+		"b":   "needs quoting",
+		"a":   1,
+		"err": errors.New("failed"),
+	}).Warn("hello world")
+
+	assert.Equal(t, `level=warning ts=2020-01-02T03:04:05.006Z msg="hello world" a=1 b="needs quoting" err=failed`+"\n", buf.String())
+}
+
+func TestFormatJSON(t *testing.T) {
+	logger, buf := newTestLogger(t, "-log.format=json", "-log.timestamp-format=2006-01-02")
+	logger.WithTime(testTime).WithFields(logrus.Fields{
+		"b":   []int{1, 2},
+		"a":   "x",
+		"err": errors.New("failed"),
+	}).Info("hello")
+
+	assert.Equal(t, `{"level":"info","ts":"2020-01-02","msg":"hello","a":"x","b":[1,2],"err":"failed"}`+"\n", buf.String())
+}
+
+func TestFormatConsole(t *testing.T) {
+	defer func(saved func(io.Writer) bool) { isTerminal = saved }(isTerminal)
+	isTerminal = func(io.Writer) bool { return true }
+
+	logger, buf := newTestLogger(t, "-log.format=console")
+	logger.WithTime(testTime).WithField("a", "b c").Error("hello")
+	assert.Equal(t, "\x1b[31mERRO\x1b[0m \x1b[90m03:04:05.006\x1b[0m hello \x1b[36ma=\x1b[0m\"b c\"\n", buf.String())
+
+	logger, buf = newTestLogger(t, "-log.format=console", "-log.no-color")
+	logger.WithTime(testTime).WithField("a", "b c").Info("hello")
+	assert.Equal(t, "INFO 03:04:05.006 hello a=\"b c\"\n", buf.String())
+
+	// Output which is not a terminal is never coloured.
+	isTerminal = func(io.Writer) bool { return false }
+	logger, buf = newTestLogger(t, "-log.format=console")
+	logger.WithTime(testTime).Warn("hello")
+	assert.Equal(t, "WARN 03:04:05.006 hello\n", buf.String())
+}
+
+func TestFormatCaller(t *testing.T) {
+	for _, format := range []string{FormatLogfmt, FormatJSON, FormatConsole} {
+		logger, buf := newTestLogger(t, "-log.format="+format, "-log.caller")
+		Logrus(logger).WithField("a", 1).Infoln("hello")
+		Logrus(logger).Infof("hello")
+		assert.Regexp(t, regexp.MustCompile(`formatter_test\.go:\d+`), buf.String(), format)
+		assert.NotContains(t, buf.String(), "logrus.go", format)
+	}
+
+	logger, buf := newTestLogger(t)
+	Logrus(logger).Infoln("hello")
+	assert.NotContains(t, buf.String(), "caller")
+}
+
+func TestFormatSet(t *testing.T) {
+	var f Format
+	assert.Error(t, f.Set("xml"))
+	require.NoError(t, f.Set("console"))
+	assert.Equal(t, "console", f.String())
+
+	// Formatters set by callers are kept.
+	text := &logrus.TextFormatter{}
+	f.Logrus = text
+	assert.Equal(t, text, f.formatter())
+}
@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"flag"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Levels are the levels of named loggers, e.g. {"httpgrpc": debug}.  The
+// level of "a" also applies to "a.b", unless it has a level of its own.
+type Levels map[string]Level
+
+// RegisterFlags adds the log levels flag to the provided flagset.
+func (l *Levels) RegisterFlags(f *flag.FlagSet) {
+	f.Var(l, "log.levels", "Comma-separated levels of named loggers, overriding -log.level, e.g. httpgrpc=debug,backoff=warn.")
+}
+
+func (l *Levels) String() string {
+	if l == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*l))
+	for name, level := range *l {
+		pairs = append(pairs, name+"="+level.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set replaces the levels with the comma-separated name=level pairs of s.
+// Implements flag.Value.
+func (l *Levels) Set(s string) error {
+	levels := Levels{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.Errorf("invalid log level %q, expected name=level", pair)
+		}
+		var level Level
+		if err := level.Set(parts[1]); err != nil {
+			return err
+		}
+		levels[parts[0]] = level
+	}
+	*l = levels
+	return nil
+}
+
+// Leveled is an Interface which drops entries below the level of the logger
+// which logs them: the level of its name, or the global level for unnamed
+// loggers.  Levels can be changed at runtime, and apply to all the loggers
+// derived from a Leveled.
+type Leveled struct {
+	next  Interface
+	name  string
+	state *levelState
+}
+
+type levelState struct {
+	mtx    sync.RWMutex
+	global logrus.Level
+	named  map[string]logrus.Level
+}
+
+// NewLeveled wraps log, which must let all entries through, e.g. a logrus
+// logger at debug level.
+func NewLeveled(log Interface, global Level, levels Levels) *Leveled {
+	state := &levelState{
+		global: global.Logrus,
+		named:  map[string]logrus.Level{},
+	}
+	for name, level := range levels {
+		state.named[name] = level.Logrus
+	}
+	return &Leveled{next: log, state: state}
+}
+
+// Named returns a child logger for the component name, nested under the name
+// of l if it has one.  The name is logged as the component field.
+func (l *Leveled) Named(name string) Interface {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	return &Leveled{
+		next:  l.next.WithField("component", name),
+		name:  name,
+		state: l.state,
+	}
+}
+
+// Named returns a child logger of log for the component name.  If log is not
+// a Leveled, or derived from one, its level cannot be set separately, but the
+// name is still logged as the component field.
+func Named(log Interface, name string) Interface {
+	if n, ok := log.(interface{ Named(string) Interface }); ok {
+		return n.Named(name)
+	}
+	return log.WithField("component", name)
+}
+
+// SetLevel sets the level of the loggers named name, or the global level if
+// name is empty.
+func (l *Leveled) SetLevel(name string, level Level) {
+	l.state.mtx.Lock()
+	defer l.state.mtx.Unlock()
+	if name == "" {
+		l.state.global = level.Logrus
+	} else {
+		l.state.named[name] = level.Logrus
+	}
+}
+
+// ResetLevel makes the loggers named name use the level of their parent
+// again.
+func (l *Leveled) ResetLevel(name string) {
+	l.state.mtx.Lock()
+	defer l.state.mtx.Unlock()
+	delete(l.state.named, name)
+}
+
+// Level returns the level applied to the loggers named name.
+func (l *Leveled) Level(name string) logrus.Level {
+	l.state.mtx.RLock()
+	defer l.state.mtx.RUnlock()
+	for {
+		if level, ok := l.state.named[name]; ok {
+			return level
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			return l.state.global
+		}
+		name = name[:i]
+	}
+}
+
+func (l *Leveled) enabled(level logrus.Level) bool {
+	return level <= l.Level(l.name)
+}
+
+func (l *Leveled) Debugf(format string, args ...interface{}) {
+	if l.enabled(logrus.DebugLevel) {
+		l.next.Debugf(format, args...)
+	}
+}
+
+func (l *Leveled) Debugln(args ...interface{}) {
+	if l.enabled(logrus.DebugLevel) {
+		l.next.Debugln(args...)
+	}
+}
+
+func (l *Leveled) Infof(format string, args ...interface{}) {
+	if l.enabled(logrus.InfoLevel) {
+		l.next.Infof(format, args...)
+	}
+}
+
+func (l *Leveled) Infoln(args ...interface{}) {
+	if l.enabled(logrus.InfoLevel) {
+		l.next.Infoln(args...)
+	}
+}
+
+func (l *Leveled) Warnf(format string, args ...interface{}) {
+	if l.enabled(logrus.WarnLevel) {
+		l.next.Warnf(format, args...)
+	}
+}
+
+func (l *Leveled) Warnln(args ...interface{}) {
+	if l.enabled(logrus.WarnLevel) {
+		l.next.Warnln(args...)
+	}
+}
+
+func (l *Leveled) Errorf(format string, args ...interface{}) {
+	if l.enabled(logrus.ErrorLevel) {
+		l.next.Errorf(format, args...)
+	}
+}
+
+func (l *Leveled) Errorln(args ...interface{}) {
+	if l.enabled(logrus.ErrorLevel) {
+		l.next.Errorln(args...)
+	}
+}
+
+func (l *Leveled) WithField(key string, value interface{}) Interface {
+	return &Leveled{next: l.next.WithField(key, value), name: l.name, state: l.state}
+}
+
+func (l *Leveled) WithFields(fields Fields) Interface {
+	return &Leveled{next: l.next.WithFields(fields), name: l.name, state: l.state}
+}
+
+// Flush flushes the wrapped logger.
+func (l *Leveled) Flush() error {
+	return Flush(l.next)
+}
+
+// Fatalf logs regardless of the level, see the package Fatalf.
+func (l *Leveled) Fatalf(format string, args ...interface{}) {
+	Fatalf(l.next, format, args...)
+}
+
+// Fatalln logs regardless of the level, see the package Fatalln.
+func (l *Leveled) Fatalln(args ...interface{}) {
+	Fatalln(l.next, args...)
+}
+
+// Panicf logs regardless of the level, see the package Panicf.
+func (l *Leveled) Panicf(format string, args ...interface{}) {
+	Panicf(l.next, format, args...)
+}
+
+// Panicln logs regardless of the level, see the package Panicln.
+func (l *Leveled) Panicln(args ...interface{}) {
+	Panicln(l.next, args...)
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func mustLevel(s string) Level {
+	var l Level
+	if err := l.Set(s); err != nil {
+		panic(err)
+	}
+	return l
+}
+
+func TestLevelsFlag(t *testing.T) {
+	var levels Levels
+	fs := flag.NewFlagSet("", flag.PanicOnError)
+	levels.RegisterFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-log.levels=httpgrpc=debug, backoff=warn"}))
+	assert.Equal(t, Levels{"httpgrpc": mustLevel("debug"), "backoff": mustLevel("warn")}, levels)
+	assert.Equal(t, "backoff=warn,httpgrpc=debug", levels.String())
+
+	assert.Error(t, levels.Set("httpgrpc"))
+	assert.Error(t, levels.Set("=debug"))
+	assert.Error(t, levels.Set("httpgrpc=loud"))
+
+	var fromYAML Levels
+	require.NoError(t, yaml.Unmarshal([]byte("{httpgrpc: debug, backoff: warn}"), &fromYAML))
+	assert.Equal(t, levels, fromYAML)
+}
+
+func TestLeveled(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	log := NewLeveled(Logrus(logger), mustLevel("info"), Levels{
+		"httpgrpc": mustLevel("debug"),
+		"backoff":  mustLevel("warn"),
+	})
+	messages := func() []string {
+		var result []string
+		for _, entry := range hook.AllEntries() {
+			result = append(result, entry.Message)
+		}
+		hook.Reset()
+		return result
+	}
+
+	log.Debugln("root debug")
+	log.WithField("a", 1).Infoln("root info")
+	Named(log, "httpgrpc").Debugf("httpgrpc debug")
+	Named(Named(log, "httpgrpc"), "client").WithFields(Fields{"a": 1}).Debugln("httpgrpc.client debug")
+	Named(log, "backoff").Infoln("backoff info")
+	Named(log, "backoff").Warnln("backoff warn")
+	assert.Equal(t, []string{"root info", "httpgrpc debug", "httpgrpc.client debug", "backoff warn"}, messages())
+
+	named := Named(log, "httpgrpc").(*Leveled).Named("client")
+	named.Infoln("named")
+	assert.Equal(t, "httpgrpc.client", hook.LastEntry().Data["component"])
+	hook.Reset()
+
+	// Levels can be changed at runtime, for loggers which already exist.
+	log.SetLevel("", mustLevel("debug"))
+	log.SetLevel("httpgrpc.client", mustLevel("error"))
+	log.ResetLevel("backoff")
+	log.Debugln("root debug")
+	named.Warnln("httpgrpc.client warn")
+	named.Errorln("httpgrpc.client error")
+	Named(log, "backoff").Debugln("backoff debug")
+	assert.Equal(t, []string{"root debug", "httpgrpc.client error", "backoff debug"}, messages())
+}
+
+func TestNamedWithoutLevels(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	Named(Logrus(logger), "httpgrpc").Infoln("hello")
+	assert.Equal(t, "httpgrpc", hook.LastEntry().Data["component"])
+}
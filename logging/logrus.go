@@ -1,24 +1,26 @@
 package logging
 
 import (
+	"io"
 	"os"
 
 	"github.com/sirupsen/logrus"
 )
 
 // NewLogrusFormat makes a new Interface backed by a logrus logger
-// format can be "json" or defaults to logfmt
+// format can be "json", "console" or defaults to logfmt
 func NewLogrusFormat(level Level, f Format) Interface {
 	log := logrus.New()
 	log.Out = os.Stderr
 	log.Level = level.Logrus
-	log.Formatter = f.Logrus
+	log.Formatter = f.formatter()
 	return logrusLogger{log}
 }
 
-// NewLogrus makes a new Interface backed by a logrus logger
+// NewLogrus makes a new Interface backed by a logrus logger, logging in the
+// logfmt format
 func NewLogrus(level Level) Interface {
-	return NewLogrusFormat(level, Format{Logrus: &logrus.TextFormatter{}})
+	return NewLogrusFormat(level, Format{})
 }
 
 // Logrus wraps an existing Logrus logger.
@@ -57,3 +59,78 @@ func (l logrusEntry) WithFields(fields Fields) Interface {
 		Entry: l.Entry.WithFields(map[string]interface{}(fields)),
 	}
 }
+
+// WithError logs err, and its stack trace if it has one, as fields.
+func (l logrusLogger) WithError(err error) Interface {
+	return l.WithFields(ErrorFields(err))
+}
+
+// Flush syncs the output of the logger, if it is a file.
+func (l logrusLogger) Flush() error {
+	return flushWriter(l.Logger.Out)
+}
+
+func (l logrusLogger) Fatalf(format string, args ...interface{}) {
+	l.Logger.Logf(logrus.FatalLevel, format, args...)
+	_ = l.Flush()
+	l.Logger.Exit(1)
+}
+
+func (l logrusLogger) Fatalln(args ...interface{}) {
+	l.Logger.Logln(logrus.FatalLevel, args...)
+	_ = l.Flush()
+	l.Logger.Exit(1)
+}
+
+func (l logrusLogger) Panicf(format string, args ...interface{}) {
+	defer l.Flush()
+	l.Logger.Panicf(format, args...)
+}
+
+func (l logrusLogger) Panicln(args ...interface{}) {
+	defer l.Flush()
+	l.Logger.Panicln(args...)
+}
+
+// WithError logs err, and its stack trace if it has one, as fields.
+func (l logrusEntry) WithError(err error) Interface {
+	return l.WithFields(ErrorFields(err))
+}
+
+// Flush syncs the output of the logger, if it is a file.
+func (l logrusEntry) Flush() error {
+	return flushWriter(l.Entry.Logger.Out)
+}
+
+func (l logrusEntry) Fatalf(format string, args ...interface{}) {
+	l.Entry.Logf(logrus.FatalLevel, format, args...)
+	_ = l.Flush()
+	l.Entry.Logger.Exit(1)
+}
+
+func (l logrusEntry) Fatalln(args ...interface{}) {
+	l.Entry.Logln(logrus.FatalLevel, args...)
+	_ = l.Flush()
+	l.Entry.Logger.Exit(1)
+}
+
+func (l logrusEntry) Panicf(format string, args ...interface{}) {
+	defer l.Flush()
+	l.Entry.Panicf(format, args...)
+}
+
+func (l logrusEntry) Panicln(args ...interface{}) {
+	defer l.Flush()
+	l.Entry.Panicln(args...)
+}
+
+// flushWriter flushes or syncs w, if it buffers.
+func flushWriter(w io.Writer) error {
+	switch w := w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+// Package logtest provides a logging.Interface which records entries, for
+// asserting on what is logged in tests.
+package logtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/videocoin/common/logging"
+)
+
+// Entry is a logged entry.
+type Entry struct {
+	Level   logrus.Level
+	Message string
+	Fields  logging.Fields
+}
+
+// HasFields returns true if the entry has all of fields, with equal values.
+func (e Entry) HasFields(fields logging.Fields) bool {
+	for k, v := range fields {
+		actual, ok := e.Fields[k]
+		if !ok || !assert.ObjectsAreEqual(v, actual) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %q %v", e.Level, e.Message, e.Fields)
+}
+
+// Logger records the entries logged with it, and with the loggers derived
+// from it, at all levels.  It is safe for concurrent use.
+type Logger struct {
+	fields   logging.Fields
+	recorder *recorder
+}
+
+type recorder struct {
+	mtx     sync.Mutex
+	entries []Entry
+}
+
+// New makes a new Logger.
+func New() *Logger {
+	return &Logger{recorder: &recorder{}}
+}
+
+// Entries returns the entries logged so far.
+func (l *Logger) Entries() []Entry {
+	l.recorder.mtx.Lock()
+	defer l.recorder.mtx.Unlock()
+	return append([]Entry(nil), l.recorder.entries...)
+}
+
+// Reset forgets the entries logged so far.
+func (l *Logger) Reset() {
+	l.recorder.mtx.Lock()
+	defer l.recorder.mtx.Unlock()
+	l.recorder.entries = nil
+}
+
+// Last returns the last logged entry, if any.
+func (l *Logger) Last() (Entry, bool) {
+	entries := l.Entries()
+	if len(entries) == 0 {
+		return Entry{}, false
+	}
+	return entries[len(entries)-1], true
+}
+
+// Messages returns the messages of the entries logged so far.
+func (l *Logger) Messages() []string {
+	var messages []string
+	for _, e := range l.Entries() {
+		messages = append(messages, e.Message)
+	}
+	return messages
+}
+
+// Filter returns the entries for which f returns true.
+func (l *Logger) Filter(f func(Entry) bool) []Entry {
+	var result []Entry
+	for _, e := range l.Entries() {
+		if f(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// FilterLevel returns the entries logged at level.
+func (l *Logger) FilterLevel(level logrus.Level) []Entry {
+	return l.Filter(func(e Entry) bool { return e.Level == level })
+}
+
+// FilterMessage returns the entries whose message contains substr.
+func (l *Logger) FilterMessage(substr string) []Entry {
+	return l.Filter(func(e Entry) bool { return strings.Contains(e.Message, substr) })
+}
+
+// FilterFields returns the entries which have all of fields.
+func (l *Logger) FilterFields(fields logging.Fields) []Entry {
+	return l.Filter(func(e Entry) bool { return e.HasFields(fields) })
+}
+
+func (l *Logger) matching(level logrus.Level, substr string, fields logging.Fields) []Entry {
+	return l.Filter(func(e Entry) bool {
+		return e.Level == level && strings.Contains(e.Message, substr) && e.HasFields(fields)
+	})
+}
+
+// AssertLogged asserts that an entry was logged at level, with a message
+// containing substr and all of fields, which may be nil.
+func (l *Logger) AssertLogged(t assert.TestingT, level logrus.Level, substr string, fields logging.Fields, msgAndArgs ...interface{}) bool {
+	if len(l.matching(level, substr, fields)) > 0 {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("No %s entry containing %q with fields %v was logged, got:\n%s",
+		level, substr, fields, l.dump()), msgAndArgs...)
+}
+
+// AssertNotLogged asserts that no entry was logged at level, with a message
+// containing substr and all of fields, which may be nil.
+func (l *Logger) AssertNotLogged(t assert.TestingT, level logrus.Level, substr string, fields logging.Fields, msgAndArgs ...interface{}) bool {
+	matching := l.matching(level, substr, fields)
+	if len(matching) == 0 {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("Unexpected %s entry containing %q with fields %v was logged: %s",
+		level, substr, fields, matching[0]), msgAndArgs...)
+}
+
+// AssertMessages asserts that exactly the messages were logged, in order.
+func (l *Logger) AssertMessages(t assert.TestingT, messages []string, msgAndArgs ...interface{}) bool {
+	return assert.Equal(t, messages, l.Messages(), msgAndArgs...)
+}
+
+func (l *Logger) dump() string {
+	var lines []string
+	for _, e := range l.Entries() {
+		lines = append(lines, "\t"+e.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l *Logger) log(level logrus.Level, msg string) {
+	fields := make(logging.Fields, len(l.fields))
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	l.recorder.mtx.Lock()
+	defer l.recorder.mtx.Unlock()
+	l.recorder.entries = append(l.recorder.entries, Entry{Level: level, Message: msg, Fields: fields})
+}
+
+func sprintln(args ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
+
+// Debugf implements logging.Interface.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(logrus.DebugLevel, fmt.Sprintf(format, args...))
+}
+
+// Debugln implements logging.Interface.
+func (l *Logger) Debugln(args ...interface{}) {
+	l.log(logrus.DebugLevel, sprintln(args...))
+}
+
+// Infof implements logging.Interface.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(logrus.InfoLevel, fmt.Sprintf(format, args...))
+}
+
+// Infoln implements logging.Interface.
+func (l *Logger) Infoln(args ...interface{}) {
+	l.log(logrus.InfoLevel, sprintln(args...))
+}
+
+// Warnf implements logging.Interface.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(logrus.WarnLevel, fmt.Sprintf(format, args...))
+}
+
+// Warnln implements logging.Interface.
+func (l *Logger) Warnln(args ...interface{}) {
+	l.log(logrus.WarnLevel, sprintln(args...))
+}
+
+// Errorf implements logging.Interface.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(logrus.ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+// Errorln implements logging.Interface.
+func (l *Logger) Errorln(args ...interface{}) {
+	l.log(logrus.ErrorLevel, sprintln(args...))
+}
+
+// Fatalf records an entry at fatal level, without exiting, for use with
+// logging.Fatalf.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.log(logrus.FatalLevel, fmt.Sprintf(format, args...))
+}
+
+// Fatalln records an entry at fatal level, without exiting, for use with
+// logging.Fatalln.
+func (l *Logger) Fatalln(args ...interface{}) {
+	l.log(logrus.FatalLevel, sprintln(args...))
+}
+
+// Panicf records an entry at panic level and panics with the message, for use
+// with logging.Panicf.
+func (l *Logger) Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	l.log(logrus.PanicLevel, msg)
+	panic(msg)
+}
+
+// Panicln records an entry at panic level and panics with the message, for
+// use with logging.Panicln.
+func (l *Logger) Panicln(args ...interface{}) {
+	msg := sprintln(args...)
+	l.log(logrus.PanicLevel, msg)
+	panic(msg)
+}
+
+// WithField implements logging.Interface.  The returned logger records to
+// the same entries as l.
+func (l *Logger) WithField(key string, value interface{}) logging.Interface {
+	return l.WithFields(logging.Fields{key: value})
+}
+
+// WithFields implements logging.Interface.  The returned logger records to
+// the same entries as l.
+func (l *Logger) WithFields(fields logging.Fields) logging.Interface {
+	merged := make(logging.Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{fields: merged, recorder: l.recorder}
+}
@@ -0,0 +1,65 @@
+package logtest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/videocoin/common/logging"
+)
+
+func TestLogger(t *testing.T) {
+	log := New()
+	var _ logging.Interface = log
+
+	log.Debugf("debug %d", 1)
+	requestLog := log.WithField("method", "GET").WithFields(logging.Fields{"route": "api"})
+	requestLog.Warnln("request", "failed")
+	logging.Named(log, "httpgrpc").Errorf("closed")
+
+	assert.Equal(t, []Entry{
+		{Level: logrus.DebugLevel, Message: "debug 1", Fields: logging.Fields{}},
+		{Level: logrus.WarnLevel, Message: "request failed", Fields: logging.Fields{"method": "GET", "route": "api"}},
+		{Level: logrus.ErrorLevel, Message: "closed", Fields: logging.Fields{"component": "httpgrpc"}},
+	}, log.Entries())
+	log.AssertMessages(t, []string{"debug 1", "request failed", "closed"})
+
+	assert.Len(t, log.FilterLevel(logrus.WarnLevel), 1)
+	assert.Len(t, log.FilterMessage("request"), 1)
+	assert.Len(t, log.FilterFields(logging.Fields{"method": "GET"}), 1)
+	assert.Empty(t, log.FilterFields(logging.Fields{"method": "POST"}))
+
+	last, ok := log.Last()
+	require.True(t, ok)
+	assert.Equal(t, "closed", last.Message)
+
+	log.AssertLogged(t, logrus.WarnLevel, "failed", logging.Fields{"route": "api"})
+	log.AssertNotLogged(t, logrus.InfoLevel, "failed", nil)
+
+	// Failing assertions report the entries.
+	mock := &testing.T{}
+	assert.False(t, log.AssertLogged(mock, logrus.WarnLevel, "failed", logging.Fields{"route": "other"}))
+	assert.False(t, log.AssertNotLogged(mock, logrus.ErrorLevel, "", nil))
+
+	log.Reset()
+	assert.Empty(t, log.Entries())
+	_, ok = log.Last()
+	assert.False(t, ok)
+}
+
+func TestLoggerConcurrent(t *testing.T) {
+	log := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			log.WithField("i", i).Infoln("hello")
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, log.FilterMessage("hello"), 10)
+}
@@ -1,5 +1,7 @@
 package logging
 
+import "fmt"
+
 // Noop logger.
 func Noop() Interface {
 	return noop{}
@@ -21,3 +23,26 @@ func (noop) WithField(key string, value interface{}) Interface {
 func (noop) WithFields(Fields) Interface {
 	return noop{}
 }
+func (noop) WithError(error) Interface {
+	return noop{}
+}
+
+// Fatalf exits with status 1, without logging.
+func (noop) Fatalf(format string, args ...interface{}) {
+	exit(1)
+}
+
+// Fatalln exits with status 1, without logging.
+func (noop) Fatalln(args ...interface{}) {
+	exit(1)
+}
+
+// Panicf panics with the message, without logging.
+func (noop) Panicf(format string, args ...interface{}) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+// Panicln panics with the message, without logging.
+func (noop) Panicln(args ...interface{}) {
+	panic(sprintln(args...))
+}
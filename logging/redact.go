@@ -0,0 +1,370 @@
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Redacted replaces redacted values.
+const Redacted = "REDACTED"
+
+var (
+	// DefaultRedactFields are the field names always redacted, regardless of
+	// case.
+	DefaultRedactFields = []string{"password", "passwd", "secret", "token", "access_token", "refresh_token", "api_key", "apikey", "authorization", "cookie"}
+
+	// DefaultRedactHeaders are the HTTP headers always redacted.
+	DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Csrf-Token"}
+
+	// DefaultRedactPatterns match bearer tokens and email addresses, which are
+	// always redacted from messages and string values.
+	DefaultRedactPatterns = []string{
+		`(?i)bearer\s+[a-z0-9\-._~+/]+=*`,
+		`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`,
+	}
+)
+
+// RedactConfig configures a Redactor, in addition to the defaults.  If
+// Enabled is false, users of the config, like server.New, use NoopRedactor
+// instead of NewRedactor.
+type RedactConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Fields   []string `yaml:"fields"`
+	Headers  []string `yaml:"headers"`
+	Patterns []string `yaml:"patterns"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *RedactConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "log.redact.enabled", true, "Redact secrets and personal data from logs. If false, nothing is redacted, not even the defaults.")
+	f.Var(commaList{&cfg.Fields}, "log.redact.fields", "Comma-separated names of fields, and proto fields, whose values are redacted from logs, in addition to the defaults.")
+	f.Var(commaList{&cfg.Headers}, "log.redact.headers", "Comma-separated HTTP headers whose values are redacted from logs, in addition to the defaults.")
+	f.Var(patternList{&cfg.Patterns}, "log.redact.patterns", "Regular expression whose matches are redacted from logged messages and values, in addition to the defaults. May be repeated.")
+}
+
+// commaList is a flag.Value for a comma-separated list of strings.
+type commaList struct {
+	values *[]string
+}
+
+func (l commaList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l commaList) Set(s string) error {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	*l.values = values
+	return nil
+}
+
+// patternList is a flag.Value for repeated regular expressions, which may
+// contain commas.
+type patternList struct {
+	values *[]string
+}
+
+func (l patternList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, " ")
+}
+
+func (l patternList) Set(s string) error {
+	if _, err := regexp.Compile(s); err != nil {
+		return err
+	}
+	*l.values = append(*l.values, s)
+	return nil
+}
+
+// Redactor removes secrets and personal data from logged values.  A nil
+// *Redactor applies the defaults.
+type Redactor struct {
+	fields   map[string]bool
+	headers  map[string]bool
+	patterns []*regexp.Regexp
+}
+
+var defaultRedactor = mustNewRedactor(RedactConfig{})
+
+func mustNewRedactor(cfg RedactConfig) *Redactor {
+	r, err := NewRedactor(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// NewRedactor makes a new Redactor for cfg and the defaults.
+func NewRedactor(cfg RedactConfig) (*Redactor, error) {
+	r := &Redactor{
+		fields:  map[string]bool{},
+		headers: map[string]bool{},
+	}
+	for _, fs := range [][]string{DefaultRedactFields, cfg.Fields} {
+		for _, f := range fs {
+			r.fields[strings.ToLower(f)] = true
+		}
+	}
+	for _, hs := range [][]string{DefaultRedactHeaders, cfg.Headers} {
+		for _, h := range hs {
+			r.headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+	for _, ps := range [][]string{DefaultRedactPatterns, cfg.Patterns} {
+		for _, p := range ps {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid redact pattern %q", p)
+			}
+			r.patterns = append(r.patterns, re)
+		}
+	}
+	return r, nil
+}
+
+// NoopRedactor returns a Redactor which redacts nothing.
+func NoopRedactor() *Redactor {
+	return &Redactor{}
+}
+
+func (r *Redactor) orDefault() *Redactor {
+	if r == nil {
+		return defaultRedactor
+	}
+	return r
+}
+
+// sensitive returns true if values of the field, or proto field, key are
+// redacted.  Only the last part of dotted keys, e.g. "request.password", is
+// considered.
+func (r *Redactor) sensitive(key string) bool {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	return r.fields[strings.ToLower(key)]
+}
+
+// String redacts the matches of the patterns from s.
+func (r *Redactor) String(s string) string {
+	for _, re := range r.orDefault().patterns {
+		s = re.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// Header returns a copy of h, with the values of sensitive headers replaced
+// and the patterns redacted from the rest.
+func (r *Redactor) Header(h http.Header) http.Header {
+	r = r.orDefault()
+	result := make(http.Header, len(h))
+	for key, values := range h {
+		redacted := make([]string, len(values))
+		for i, v := range values {
+			if r.headers[http.CanonicalHeaderKey(key)] {
+				redacted[i] = Redacted
+			} else {
+				redacted[i] = r.String(v)
+			}
+		}
+		result[key] = redacted
+	}
+	return result
+}
+
+// Field returns the value to log for the field key.  Values of sensitive
+// fields are replaced, strings and errors have the patterns redacted, and
+// headers and proto messages are redacted as by Header and Proto.
+func (r *Redactor) Field(key string, value interface{}) interface{} {
+	r = r.orDefault()
+	if r.sensitive(key) {
+		return Redacted
+	}
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case error:
+		// Only replace errors which need redacting, to keep their type.
+		if s := v.Error(); r.String(s) != s {
+			return r.String(s)
+		}
+	case http.Header:
+		return r.Header(v)
+	case proto.Message:
+		return r.Proto(v)
+	}
+	return value
+}
+
+// Fields redacts each of fields, as by Field.
+func (r *Redactor) Fields(fields Fields) Fields {
+	result := make(Fields, len(fields))
+	for k, v := range fields {
+		result[k] = r.Field(k, v)
+	}
+	return result
+}
+
+// Proto returns a copy of m with sensitive fields redacted: those named like
+// sensitive fields or annotated with the debug_redact option, e.g.
+//
+//	string password = 1 [debug_redact = true];
+//
+// Sensitive string fields are replaced, other types are cleared, and the
+// patterns are redacted from the rest of the strings, in nested messages too.
+func (r *Redactor) Proto(m proto.Message) proto.Message {
+	if m == nil {
+		return nil
+	}
+	clone := proto.Clone(m)
+	r.orDefault().redactMessage(proto.MessageReflect(clone))
+	return clone
+}
+
+func (r *Redactor) redactMessage(m protoreflect.Message) {
+	// Collect the fields first, as the message may not be changed while
+	// ranging over it.
+	type field struct {
+		fd    protoreflect.FieldDescriptor
+		value protoreflect.Value
+	}
+	var fields []field
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		fields = append(fields, field{fd, v})
+		return true
+	})
+
+	for _, f := range fields {
+		fd := f.fd
+		switch {
+		case r.sensitiveProtoField(fd):
+			if fd.Kind() == protoreflect.StringKind && fd.Cardinality() != protoreflect.Repeated {
+				m.Set(fd, protoreflect.ValueOfString(Redacted))
+			} else {
+				m.Clear(fd)
+			}
+		case fd.IsMap():
+			mv := f.value.Map()
+			mv.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				switch fd.MapValue().Kind() {
+				case protoreflect.MessageKind, protoreflect.GroupKind:
+					r.redactMessage(v.Message())
+				case protoreflect.StringKind:
+					mv.Set(k, protoreflect.ValueOfString(r.String(v.String())))
+				}
+				return true
+			})
+		case fd.IsList():
+			list := f.value.List()
+			for i := 0; i < list.Len(); i++ {
+				switch fd.Kind() {
+				case protoreflect.MessageKind, protoreflect.GroupKind:
+					r.redactMessage(list.Get(i).Message())
+				case protoreflect.StringKind:
+					list.Set(i, protoreflect.ValueOfString(r.String(list.Get(i).String())))
+				}
+			}
+		case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+			r.redactMessage(f.value.Message())
+		case fd.Kind() == protoreflect.StringKind:
+			m.Set(fd, protoreflect.ValueOfString(r.String(f.value.String())))
+		}
+	}
+}
+
+func (r *Redactor) sensitiveProtoField(fd protoreflect.FieldDescriptor) bool {
+	if r.sensitive(string(fd.Name())) {
+		return true
+	}
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	return ok && opts.GetDebugRedact()
+}
+
+// NewRedacting wraps log so that the patterns of r are redacted from messages,
+// and fields are redacted as by r.Field.
+func NewRedacting(log Interface, r *Redactor) Interface {
+	return redactingLogger{next: log, redactor: r.orDefault()}
+}
+
+type redactingLogger struct {
+	next     Interface
+	redactor *Redactor
+}
+
+func (l redactingLogger) Debugf(format string, args ...interface{}) {
+	l.next.Debugln(l.redactor.String(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Debugln(args ...interface{}) {
+	l.next.Debugln(l.redactor.String(sprintln(args...)))
+}
+
+func (l redactingLogger) Infof(format string, args ...interface{}) {
+	l.next.Infoln(l.redactor.String(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Infoln(args ...interface{}) {
+	l.next.Infoln(l.redactor.String(sprintln(args...)))
+}
+
+func (l redactingLogger) Warnf(format string, args ...interface{}) {
+	l.next.Warnln(l.redactor.String(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Warnln(args ...interface{}) {
+	l.next.Warnln(l.redactor.String(sprintln(args...)))
+}
+
+func (l redactingLogger) Errorf(format string, args ...interface{}) {
+	l.next.Errorln(l.redactor.String(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Errorln(args ...interface{}) {
+	l.next.Errorln(l.redactor.String(sprintln(args...)))
+}
+
+func (l redactingLogger) WithField(key string, value interface{}) Interface {
+	return redactingLogger{next: l.next.WithField(key, l.redactor.Field(key, value)), redactor: l.redactor}
+}
+
+func (l redactingLogger) WithFields(fields Fields) Interface {
+	return redactingLogger{next: l.next.WithFields(l.redactor.Fields(fields)), redactor: l.redactor}
+}
+
+// Flush flushes the wrapped logger.
+func (l redactingLogger) Flush() error {
+	return Flush(l.next)
+}
+
+func (l redactingLogger) Fatalf(format string, args ...interface{}) {
+	Fatalln(l.next, l.redactor.String(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Fatalln(args ...interface{}) {
+	Fatalln(l.next, l.redactor.String(sprintln(args...)))
+}
+
+func (l redactingLogger) Panicf(format string, args ...interface{}) {
+	Panicln(l.next, l.redactor.String(fmt.Sprintf(format, args...)))
+}
+
+func (l redactingLogger) Panicln(args ...interface{}) {
+	Panicln(l.next, l.redactor.String(sprintln(args...)))
+}
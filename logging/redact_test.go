@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestRedactConfigFlags(t *testing.T) {
+	var cfg RedactConfig
+	fs := flag.NewFlagSet("", flag.PanicOnError)
+	cfg.RegisterFlags(fs)
+	require.NoError(t, fs.Parse([]string{
+		"-log.redact.enabled=false",
+		"-log.redact.fields=ssn, card_number",
+		"-log.redact.headers=X-Api-Key",
+		"-log.redact.patterns=[0-9]{4}-[0-9]{4}",
+		"-log.redact.patterns=sk_[a-z]+",
+	}))
+	assert.Equal(t, RedactConfig{
+		Enabled:  false,
+		Fields:   []string{"ssn", "card_number"},
+		Headers:  []string{"X-Api-Key"},
+		Patterns: []string{"[0-9]{4}-[0-9]{4}", "sk_[a-z]+"},
+	}, cfg)
+	assert.Error(t, fs.Set("log.redact.patterns", "("))
+
+	_, err := NewRedactor(RedactConfig{Patterns: []string{"("}})
+	assert.Error(t, err)
+}
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor(RedactConfig{
+		Fields:   []string{"ssn"},
+		Headers:  []string{"X-Api-Key"},
+		Patterns: []string{"sk_[a-z]+"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, Redacted, r.Field("Password", "hunter2"))
+	assert.Equal(t, Redacted, r.Field("user.ssn", "123"))
+	assert.Equal(t, "key REDACTED", r.Field("msg", "key sk_abc"))
+	assert.Equal(t, "sent to REDACTED", r.Field("err", errors.New("sent to jane@example.com")))
+	plain := errors.New("failed")
+	assert.Equal(t, plain, r.Field("err", plain))
+	assert.Equal(t, 42, r.Field("count", 42))
+
+	assert.Equal(t, http.Header{
+		"Authorization": {Redacted},
+		"X-Api-Key":     {Redacted},
+		"X-Forwarded":   {"for=REDACTED"},
+		"Accept":        {"*/*"},
+	}, r.Field("headers", http.Header{
+		"Authorization": {"Bearer abc"},
+		"X-Api-Key":     {"abc"},
+		"X-Forwarded":   {"for=jane@example.com"},
+		"Accept":        {"*/*"},
+	}))
+
+	// The defaults apply to a nil Redactor.
+	var nilRedactor *Redactor
+	assert.Equal(t, "Authorization: REDACTED", nilRedactor.String("Authorization: Bearer abc.def"))
+	assert.Equal(t, "sk_abc", nilRedactor.String("sk_abc"))
+
+	// And none to a NoopRedactor.
+	noop := NoopRedactor()
+	assert.Equal(t, "Bearer abc.def", noop.String("Bearer abc.def"))
+	assert.Equal(t, "hunter2", noop.Field("password", "hunter2"))
+	assert.Equal(t, http.Header{"Authorization": {"Bearer abc"}}, noop.Header(http.Header{"Authorization": {"Bearer abc"}}))
+}
+
+// testMessage makes a message type with a field annotated with debug_redact,
+// without generated code.
+func testMessage(t *testing.T) protoreflect.MessageType {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    protov2.String("test.proto"),
+		Package: protov2.String("test"),
+		Syntax:  protov2.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: protov2.String("Login"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: protov2.String("user"), JsonName: protov2.String("user"), Number: protov2.Int32(1), Type: str, Label: optional},
+				{Name: protov2.String("pin"), JsonName: protov2.String("pin"), Number: protov2.Int32(2), Type: str, Label: optional,
+					Options: &descriptorpb.FieldOptions{DebugRedact: protov2.Bool(true)}},
+				{Name: protov2.String("password"), JsonName: protov2.String("password"), Number: protov2.Int32(3), Type: str, Label: optional},
+				{Name: protov2.String("next"), JsonName: protov2.String("next"), Number: protov2.Int32(4), Type: msg, Label: repeated, TypeName: protov2.String(".test.Login")},
+			},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	return dynamicpb.NewMessageType(file.Messages().Get(0))
+}
+
+func TestRedactorProto(t *testing.T) {
+	mt := testMessage(t)
+	fields := mt.Descriptor().Fields()
+	newLogin := func(user string) protoreflect.Message {
+		m := mt.New()
+		m.Set(fields.ByName("user"), protoreflect.ValueOfString(user))
+		m.Set(fields.ByName("pin"), protoreflect.ValueOfString("1234"))
+		m.Set(fields.ByName("password"), protoreflect.ValueOfString("hunter2"))
+		return m
+	}
+	login := newLogin("jane@example.com")
+	next := login.Mutable(fields.ByName("next")).List()
+	next.Append(protoreflect.ValueOfMessage(newLogin("john@example.com")))
+
+	redacted := (*Redactor)(nil).Field("request", login.Interface()).(*dynamicpb.Message)
+	for _, m := range []protoreflect.Message{redacted, redacted.Get(fields.ByName("next")).List().Get(0).Message()} {
+		assert.Equal(t, Redacted, m.Get(fields.ByName("user")).String())
+		assert.Equal(t, Redacted, m.Get(fields.ByName("pin")).String())
+		assert.Equal(t, Redacted, m.Get(fields.ByName("password")).String())
+	}
+
+	// The original is left alone.
+	assert.Equal(t, "jane@example.com", login.Get(fields.ByName("user")).String())
+	assert.Equal(t, "1234", login.Get(fields.ByName("pin")).String())
+}
+
+func TestRedacting(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	log := NewRedacting(Logrus(logger), nil)
+
+	log.WithFields(Fields{"token": "abc", "user": "jane@example.com"}).WithField("n", 1).Infof("login by %s", "jane@example.com")
+	entry := hook.LastEntry()
+	assert.Equal(t, "login by REDACTED", entry.Message)
+	assert.Equal(t, Redacted, entry.Data["token"])
+	assert.Equal(t, Redacted, entry.Data["user"])
+	assert.Equal(t, 1, entry.Data["n"])
+}
@@ -0,0 +1,246 @@
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/videocoin/common/instrument/registry"
+)
+
+// SamplingConfig configures NewSampling.  Messages are counted per level and
+// text, ignoring their fields.
+//
+// Setting First to 1, Thereafter to 0 and Summarize suppresses duplicates:
+// each message is logged once per interval, followed by how many times it was
+// repeated.
+type SamplingConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	// First is the number of times a message is logged per interval; 0
+	// disables sampling.
+	First int `yaml:"first"`
+	// Thereafter is the sampling rate of the rest: every Thereafter-th
+	// message is logged, or none if 0.
+	Thereafter int `yaml:"thereafter"`
+	// Summarize logs how many times each dropped message was repeated, at the
+	// end of each interval.
+	Summarize bool `yaml:"summarize"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *SamplingConfig) RegisterFlags(f *flag.FlagSet) {
+	f.DurationVar(&cfg.Interval, "log.sampling.interval", time.Second, "Interval over which identical log messages are sampled.")
+	f.IntVar(&cfg.First, "log.sampling.first", 0, "Number of identical log messages logged per interval before sampling them; 0 disables sampling.")
+	f.IntVar(&cfg.Thereafter, "log.sampling.thereafter", 100, "Log every Nth identical message once log.sampling.first have been logged in an interval; 0 drops them all.")
+	f.BoolVar(&cfg.Summarize, "log.sampling.summarize", false, "Log how many times dropped messages were repeated at the end of each interval.")
+}
+
+type samplingLevel int
+
+const (
+	sampleDebug samplingLevel = iota
+	sampleInfo
+	sampleWarn
+	sampleError
+)
+
+var samplingLevelNames = []string{"debug", "info", "warn", "error"}
+
+type sampleKey struct {
+	level samplingLevel
+	msg   string
+}
+
+type sampleCount struct {
+	seen, dropped int
+	// log is the logger of the last dropped message, used to summarize.
+	log Interface
+}
+
+type sampler struct {
+	cfg     SamplingConfig
+	dropped *prometheus.CounterVec
+
+	mtx       sync.Mutex
+	windowEnd time.Time
+	counts    map[sampleKey]*sampleCount
+	timer     *time.Timer
+}
+
+// NewSampling wraps log so that messages repeated within an interval are
+// sampled, see SamplingConfig.  The number of dropped messages is counted by
+// level in a metric registered with reg, or the default Prometheus registry
+// if reg is nil.  If sampling is disabled, log is returned as it is.
+func NewSampling(log Interface, cfg SamplingConfig, reg prometheus.Registerer) Interface {
+	if cfg.First <= 0 || cfg.Interval <= 0 {
+		return log
+	}
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	dropped := registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_messages_dropped_total",
+		Help: "Total number of log messages dropped by sampling.",
+	}, []string{"level"})).(*prometheus.CounterVec)
+
+	return samplingLogger{
+		next: log,
+		sampler: &sampler{
+			cfg:     cfg,
+			dropped: dropped,
+			counts:  map[sampleKey]*sampleCount{},
+		},
+	}
+}
+
+// allow returns true if the message should be logged.
+func (s *sampler) allow(level samplingLevel, msg string, log Interface) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now()
+	if !now.Before(s.windowEnd) {
+		s.flushLocked()
+		s.windowEnd = now.Add(s.cfg.Interval)
+	}
+
+	key := sampleKey{level: level, msg: msg}
+	count, ok := s.counts[key]
+	if !ok {
+		count = &sampleCount{}
+		s.counts[key] = count
+	}
+	count.seen++
+	if count.seen <= s.cfg.First {
+		return true
+	}
+	if s.cfg.Thereafter > 0 && (count.seen-s.cfg.First)%s.cfg.Thereafter == 0 {
+		return true
+	}
+
+	count.dropped++
+	count.log = log
+	s.dropped.WithLabelValues(samplingLevelNames[level]).Inc()
+	if s.cfg.Summarize && s.timer == nil {
+		// Summarize at the end of the interval, even if nothing else gets
+		// logged by then.
+		s.timer = time.AfterFunc(time.Until(s.windowEnd), s.flush)
+	}
+	return false
+}
+
+func (s *sampler) flush() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !time.Now().Before(s.windowEnd) {
+		s.flushLocked()
+	}
+}
+
+// flushLocked summarizes the dropped messages and starts a new interval.
+func (s *sampler) flushLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.cfg.Summarize {
+		for key, count := range s.counts {
+			if count.dropped > 0 {
+				logAt(count.log, key.level, fmt.Sprintf("%s (repeated %d times)", key.msg, count.dropped))
+			}
+		}
+	}
+	s.counts = map[sampleKey]*sampleCount{}
+}
+
+func logAt(log Interface, level samplingLevel, msg string) {
+	switch level {
+	case sampleDebug:
+		log.Debugln(msg)
+	case sampleInfo:
+		log.Infoln(msg)
+	case sampleWarn:
+		log.Warnln(msg)
+	default:
+		log.Errorln(msg)
+	}
+}
+
+type samplingLogger struct {
+	next    Interface
+	sampler *sampler
+}
+
+func (l samplingLogger) log(level samplingLevel, msg string) {
+	if l.sampler.allow(level, msg, l.next) {
+		logAt(l.next, level, msg)
+	}
+}
+
+func (l samplingLogger) Debugf(format string, args ...interface{}) {
+	l.log(sampleDebug, fmt.Sprintf(format, args...))
+}
+
+func (l samplingLogger) Debugln(args ...interface{}) {
+	l.log(sampleDebug, sprintln(args...))
+}
+
+func (l samplingLogger) Infof(format string, args ...interface{}) {
+	l.log(sampleInfo, fmt.Sprintf(format, args...))
+}
+
+func (l samplingLogger) Infoln(args ...interface{}) {
+	l.log(sampleInfo, sprintln(args...))
+}
+
+func (l samplingLogger) Warnf(format string, args ...interface{}) {
+	l.log(sampleWarn, fmt.Sprintf(format, args...))
+}
+
+func (l samplingLogger) Warnln(args ...interface{}) {
+	l.log(sampleWarn, sprintln(args...))
+}
+
+func (l samplingLogger) Errorf(format string, args ...interface{}) {
+	l.log(sampleError, fmt.Sprintf(format, args...))
+}
+
+func (l samplingLogger) Errorln(args ...interface{}) {
+	l.log(sampleError, sprintln(args...))
+}
+
+func (l samplingLogger) WithField(key string, value interface{}) Interface {
+	return samplingLogger{next: l.next.WithField(key, value), sampler: l.sampler}
+}
+
+func (l samplingLogger) WithFields(fields Fields) Interface {
+	return samplingLogger{next: l.next.WithFields(fields), sampler: l.sampler}
+}
+
+// Flush flushes the wrapped logger.
+func (l samplingLogger) Flush() error {
+	return Flush(l.next)
+}
+
+// Fatalf is never sampled, see the package Fatalf.
+func (l samplingLogger) Fatalf(format string, args ...interface{}) {
+	Fatalf(l.next, format, args...)
+}
+
+// Fatalln is never sampled, see the package Fatalln.
+func (l samplingLogger) Fatalln(args ...interface{}) {
+	Fatalln(l.next, args...)
+}
+
+// Panicf is never sampled, see the package Panicf.
+func (l samplingLogger) Panicf(format string, args ...interface{}) {
+	Panicf(l.next, format, args...)
+}
+
+// Panicln is never sampled, see the package Panicln.
+func (l samplingLogger) Panicln(args ...interface{}) {
+	Panicln(l.next, args...)
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampling(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	reg := prometheus.NewRegistry()
+	log := NewSampling(Logrus(logger), SamplingConfig{
+		Interval:   time.Hour,
+		First:      2,
+		Thereafter: 3,
+	}, reg)
+
+	for i := 0; i < 10; i++ {
+		log.WithField("i", i).Warnln("unavailable")
+		log.Infof("request %d", i)
+	}
+	log.Errorln("unavailable")
+
+	var warnings []interface{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "unavailable" && entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Data["i"])
+		}
+	}
+	// The first 2 and every 3rd after them, regardless of fields.
+	assert.Equal(t, []interface{}{0, 1, 4, 7}, warnings)
+	// Other messages and levels are counted separately.
+	assert.Len(t, hook.AllEntries(), 4+10+1)
+	assert.Equal(t, float64(6), testutil.ToFloat64(log.(samplingLogger).sampler.dropped.WithLabelValues("warn")))
+}
+
+func TestSamplingSummarize(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	log := NewSampling(Logrus(logger), SamplingConfig{
+		Interval:  50 * time.Millisecond,
+		First:     1,
+		Summarize: true,
+	}, prometheus.NewRegistry())
+
+	for i := 0; i < 5; i++ {
+		log.WithField("i", i).Warnln("unavailable")
+	}
+	require.Len(t, hook.AllEntries(), 1)
+
+	// The summary is logged at the end of the interval, with the fields of
+	// the last dropped message.
+	require.Eventually(t, func() bool {
+		return len(hook.AllEntries()) == 2
+	}, time.Second, 10*time.Millisecond)
+	summary := hook.LastEntry()
+	assert.Equal(t, "unavailable (repeated 4 times)", summary.Message)
+	assert.Equal(t, logrus.WarnLevel, summary.Level)
+	assert.Equal(t, 4, summary.Data["i"])
+
+	// A new interval starts afresh.
+	log.Warnln("unavailable")
+	assert.Len(t, hook.AllEntries(), 3)
+}
+
+func TestSamplingDisabled(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	log := Logrus(logger)
+	assert.Equal(t, log, NewSampling(log, SamplingConfig{Interval: time.Second}, nil))
+}
@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Slog makes a new Interface writing to an slog.Handler.
+func Slog(h slog.Handler) Interface {
+	return slogLogger{handler: h}
+}
+
+type slogLogger struct {
+	handler slog.Handler
+}
+
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Debugln(args ...interface{}) {
+	l.log(slog.LevelDebug, sprintln(args...))
+}
+
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Infoln(args ...interface{}) {
+	l.log(slog.LevelInfo, sprintln(args...))
+}
+
+func (l slogLogger) Warnf(format string, args ...interface{}) {
+	l.log(slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Warnln(args ...interface{}) {
+	l.log(slog.LevelWarn, sprintln(args...))
+}
+
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.log(slog.LevelError, fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Errorln(args ...interface{}) {
+	l.log(slog.LevelError, sprintln(args...))
+}
+
+func (l slogLogger) WithField(key string, value interface{}) Interface {
+	return slogLogger{handler: l.handler.WithAttrs([]slog.Attr{slog.Any(key, value)})}
+}
+
+func (l slogLogger) WithFields(fields Fields) Interface {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, k := range keys {
+		attrs = append(attrs, slog.Any(k, fields[k]))
+	}
+	return slogLogger{handler: l.handler.WithAttrs(attrs)}
+}
+
+// log a message, with the caller of the Interface methods as its source.
+func (l slogLogger) log(level slog.Level, msg string) {
+	ctx := context.Background()
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), level, msg, callerPC())
+	_ = l.handler.Handle(ctx, r)
+}
+
+// callerPC returns the program counter of the first frame outside of this
+// package.
+func callerPC() uintptr {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	for _, pc := range pcs[:n] {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		if !isLoggingFrame(frame) {
+			return pc
+		}
+	}
+	return 0
+}
+
+// sprintln formats like the ln methods of logrus, without a trailing newline.
+func sprintln(args ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
+
+// NewSlogHandler makes an slog.Handler writing to log, so that code using
+// log/slog logs like the rest of a service.  Attributes become fields, named
+// after their groups, e.g. "request.method".
+func NewSlogHandler(log Interface) slog.Handler {
+	return slogHandler{log: log}
+}
+
+type slogHandler struct {
+	log    Interface
+	prefix string
+}
+
+// Enabled implements slog.Handler.  Interface has no way of telling, so all
+// levels are enabled and filtered by log.
+func (h slogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+// Handle implements slog.Handler.
+func (h slogHandler) Handle(_ context.Context, r slog.Record) error {
+	log := h.log
+	if r.NumAttrs() > 0 {
+		fields := Fields{}
+		r.Attrs(func(a slog.Attr) bool {
+			addAttr(fields, h.prefix, a)
+			return true
+		})
+		log = log.WithFields(fields)
+	}
+
+	switch {
+	case r.Level < slog.LevelInfo:
+		log.Debugln(r.Message)
+	case r.Level < slog.LevelWarn:
+		log.Infoln(r.Message)
+	case r.Level < slog.LevelError:
+		log.Warnln(r.Message)
+	default:
+		log.Errorln(r.Message)
+	}
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := Fields{}
+	for _, a := range attrs {
+		addAttr(fields, h.prefix, a)
+	}
+	return slogHandler{log: h.log.WithFields(fields), prefix: h.prefix}
+}
+
+// WithGroup implements slog.Handler.
+func (h slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return slogHandler{log: h.log, prefix: h.prefix + name + "."}
+}
+
+func addAttr(fields Fields, prefix string, a slog.Attr) {
+	value := a.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range value.Group() {
+			addAttr(fields, prefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	fields[prefix+a.Key] = value.Any()
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Slog(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			if a.Key == slog.SourceKey {
+				source := a.Value.Any().(*slog.Source)
+				source.File = source.File[strings.LastIndex(source.File, "/")+1:]
+			}
+			return a
+		},
+	}))
+
+	log.Debugln("hidden")
+	log.WithField("a", 1).WithFields(Fields{"c": "x", "b": true}).Infoln("hello", "world")
+	log.Warnf("%d%%", 100)
+	log.Errorln("failed")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^level=INFO source=slog_test.go:\d+ msg="hello world" a=1 b=true c=x$`, lines[0])
+	assert.Regexp(t, `^level=WARN source=slog_test.go:\d+ msg=100%$`, lines[1])
+	assert.Regexp(t, `^level=ERROR source=slog_test.go:\d+ msg=failed$`, lines[2])
+}
+
+func TestSlogHandler(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	log := slog.New(NewSlogHandler(Logrus(logger)))
+
+	log.Debug("debug")
+	log.With("a", 1).WithGroup("request").Info("info", "method", "GET", slog.Group("user", "id", 2))
+	log.Warn("warn", slog.Group("", "inlined", true), slog.Group("empty"))
+	log.Error("error", "err", assert.AnError)
+
+	entries := hook.AllEntries()
+	assert.Len(t, entries, 4)
+	for i, level := range []logrus.Level{logrus.DebugLevel, logrus.InfoLevel, logrus.WarnLevel, logrus.ErrorLevel} {
+		assert.Equal(t, level, entries[i].Level)
+		assert.Equal(t, level.String(), strings.Replace(entries[i].Message, "warn", "warning", 1))
+	}
+	assert.Equal(t, logrus.Fields{"a": int64(1), "request.method": "GET", "request.user.id": int64(2)}, entries[1].Data)
+	assert.Equal(t, logrus.Fields{"inlined": true}, entries[2].Data)
+	assert.Equal(t, logrus.Fields{"err": assert.AnError}, entries[3].Data)
+}
@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// Zap wraps an existing zap logger.
+func Zap(l *zap.Logger) Interface {
+	return zapLogger{l.Sugar()}
+}
+
+type zapLogger struct {
+	*zap.SugaredLogger
+}
+
+func (l zapLogger) WithField(key string, value interface{}) Interface {
+	return zapLogger{l.SugaredLogger.With(key, value)}
+}
+
+func (l zapLogger) WithFields(fields Fields) Interface {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := make([]interface{}, 0, 2*len(fields))
+	for _, k := range keys {
+		args = append(args, k, fields[k])
+	}
+	return zapLogger{l.SugaredLogger.With(args...)}
+}
+
+// Flush syncs the buffered entries of the logger.
+func (l zapLogger) Flush() error {
+	return l.SugaredLogger.Sync()
+}
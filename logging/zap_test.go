@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestZap(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	log := Zap(zap.New(core, zap.AddCaller()))
+
+	log.Debugln("hidden")
+	log.WithField("a", 1).WithFields(Fields{"c": "x", "b": true}).Infoln("hello", "world")
+	log.Warnf("%d%%", 100)
+	log.Errorln("failed")
+
+	entries := logs.AllUntimed()
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "hello world", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"a": int64(1), "b": true, "c": "x"}, entries[0].ContextMap())
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	assert.Equal(t, "100%", entries[1].Message)
+	assert.Equal(t, zapcore.ErrorLevel, entries[2].Level)
+	for _, entry := range entries {
+		assert.Contains(t, entry.Caller.File, "zap_test.go")
+	}
+}
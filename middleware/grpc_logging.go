@@ -1,41 +1,66 @@
 package middleware
 
 import (
+	"strings"
 	"time"
 
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	grpcUtils "github.com/videocoin/common/grpc"
 	"github.com/videocoin/common/logging"
+	"github.com/videocoin/common/tracing"
 	"github.com/videocoin/common/user"
 )
 
-const (
-	gRPC     = "gRPC"
-	errorKey = "err"
-)
+const gRPC = "gRPC"
 
-// GRPCServerLog logs grpc requests, errors, and latency.
+// GRPCServerLog logs grpc requests, errors, and latency.  It also stores a
+// logger with the fields of the request in its context, for handlers to get
+// with logging.FromContext.
 type GRPCServerLog struct {
 	Log logging.Interface
 	// WithRequest will log the entire request rather than just the error
 	WithRequest bool
+	// Redactor redacts logged requests, or the defaults if nil.
+	Redactor *logging.Redactor
+}
+
+// logWithRequest information from the request and context as fields.
+func (s GRPCServerLog) logWithRequest(ctx context.Context, method string) logging.Interface {
+	log := s.Log.WithField("method", method)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if requestIDs := md[strings.ToLower(RequestIDHeader)]; len(requestIDs) == 1 {
+			log = log.WithField("requestID", requestIDs[0])
+		}
+	}
+	if traceID, ok := tracing.ExtractTraceID(ctx); ok {
+		log = log.WithField("traceID", traceID)
+	}
+	// The org ID is usually only put in the context by interceptors running
+	// after this one, so fall back to the metadata.
+	if _, err := user.ExtractOrgID(ctx); err != nil {
+		_, ctx, _ = user.ExtractFromGRPCRequest(ctx)
+	}
+	return user.LogWith(ctx, log)
 }
 
 // UnaryServerInterceptor returns an interceptor that logs gRPC requests
 func (s GRPCServerLog) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	begin := time.Now()
-	resp, err := handler(ctx, req)
-	entry := user.LogWith(ctx, s.Log).WithFields(logging.Fields{"method": info.FullMethod, "duration": time.Since(begin)})
+	requestLog := s.logWithRequest(ctx, info.FullMethod)
+	resp, err := handler(logging.WithContext(ctx, requestLog), req)
+	entry := requestLog.WithField("duration", time.Since(begin))
 	if err != nil {
 		if s.WithRequest {
-			entry = entry.WithField("request", req)
+			entry = entry.WithField("request", s.Redactor.Field("request", req))
 		}
 		if grpcUtils.IsCanceled(err) {
-			entry.WithField(errorKey, err).Debugln(gRPC)
+			logging.WithError(entry, err).Debugln(gRPC)
 		} else {
-			entry.WithField(errorKey, err).Warnln(gRPC)
+			logging.WithError(entry, err).Warnln(gRPC)
 		}
 	} else {
 		entry.Debugf("%s (success)", gRPC)
@@ -46,13 +71,16 @@ func (s GRPCServerLog) UnaryServerInterceptor(ctx context.Context, req interface
 // StreamServerInterceptor returns an interceptor that logs gRPC requests
 func (s GRPCServerLog) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 	begin := time.Now()
-	err := handler(srv, ss)
-	entry := user.LogWith(ss.Context(), s.Log).WithFields(logging.Fields{"method": info.FullMethod, "duration": time.Since(begin)})
+	requestLog := s.logWithRequest(ss.Context(), info.FullMethod)
+	wrapped := grpc_middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = logging.WithContext(ss.Context(), requestLog)
+	err := handler(srv, wrapped)
+	entry := requestLog.WithField("duration", time.Since(begin))
 	if err != nil {
 		if grpcUtils.IsCanceled(err) {
-			entry.WithField(errorKey, err).Debugln(gRPC)
+			logging.WithError(entry, err).Debugln(gRPC)
 		} else {
-			entry.WithField(errorKey, err).Warnln(gRPC)
+			logging.WithError(entry, err).Warnln(gRPC)
 		}
 	} else {
 		entry.Debugf("%s (success)", gRPC)
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/videocoin/common/httpgrpc"
+	"github.com/videocoin/common/logging"
+)
+
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestGRPCServerLogContext(t *testing.T) {
+	logrusLogger, hook := test.NewNullLogger()
+	logrusLogger.Level = logrus.DebugLevel
+	serverLog := GRPCServerLog{Log: logging.Logrus(logrusLogger)}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-scope-orgid", "org",
+		"x-request-id", "id",
+	))
+	expected := logrus.Fields{
+		"method":    "/test/Method",
+		"requestID": "id",
+		"orgID":     "org",
+	}
+
+	_, err := serverLog.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			logging.FromContext(ctx).Infoln("unary")
+			return nil, nil
+		})
+	require.NoError(t, err)
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	require.Equal(t, "unary", entries[0].Message)
+	require.Equal(t, expected, entries[0].Data)
+	require.Contains(t, entries[1].Data, "duration")
+
+	hook.Reset()
+	err = serverLog.StreamServerInterceptor(nil, contextServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/test/Method"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			logging.FromContext(ss.Context()).Infoln("stream")
+			return errors.New("failed")
+		})
+	require.Error(t, err)
+	entries = hook.AllEntries()
+	require.Len(t, entries, 2)
+	require.Equal(t, "stream", entries[0].Message)
+	require.Equal(t, expected, entries[0].Data)
+	require.Equal(t, logrus.WarnLevel, entries[1].Level)
+}
+
+func TestGRPCServerLogRedactsRequest(t *testing.T) {
+	logrusLogger, hook := test.NewNullLogger()
+	serverLog := GRPCServerLog{Log: logging.Logrus(logrusLogger), WithRequest: true}
+	req := &httpgrpc.HTTPRequest{
+		Method: "GET",
+		Url:    "/users/jane@example.com",
+		Headers: []*httpgrpc.Header{
+			{Key: "Authorization", Values: []string{"Bearer abc"}},
+		},
+	}
+
+	_, err := serverLog.UnaryServerInterceptor(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: "/test/Method"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, errors.New("failed")
+		})
+	require.Error(t, err)
+	logged := hook.LastEntry().Data["request"].(*httpgrpc.HTTPRequest)
+	require.Equal(t, "/users/REDACTED", logged.Url)
+	require.Equal(t, []string{"REDACTED"}, logged.Headers[0].Values)
+	require.Equal(t, "/users/jane@example.com", req.Url)
+}
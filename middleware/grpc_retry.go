@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/videocoin/common/backoff"
+	"github.com/videocoin/common/instrument/registry"
+)
+
+// DefaultRetryableCodes are the status codes GRPCRetry retries, unless
+// configured otherwise.
+var DefaultRetryableCodes = []codes.Code{codes.Unavailable, codes.ResourceExhausted, codes.Aborted}
+
+// GRPCRetry retries failed gRPC client calls following a backoff.RetryPolicy.
+// Calls are only retried while their context is live, and the sleep before a
+// retry is cut short by the context's deadline.
+type GRPCRetry struct {
+	Policy backoff.RetryPolicy
+	// RetryableCodes default to DefaultRetryableCodes.
+	RetryableCodes []codes.Code
+
+	retries *prometheus.CounterVec
+}
+
+// NewGRPCRetry makes a new GRPCRetry, registering its metrics with reg, or
+// the default Prometheus registry if reg is nil.  GRPCRetrys registered with
+// the same reg share their metrics.
+func NewGRPCRetry(policy backoff.RetryPolicy, reg prometheus.Registerer) (*GRPCRetry, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	return &GRPCRetry{
+		Policy: policy,
+		retries: registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_retries_total",
+			Help: "Total number of retried gRPC client calls.",
+		}, []string{"method"})).(*prometheus.CounterVec),
+	}, nil
+}
+
+type retryOptions struct {
+	policy         backoff.RetryPolicy
+	retryableCodes []codes.Code
+}
+
+// retryCallOption overrides the GRPCRetry options of a single call.
+type retryCallOption struct {
+	grpc.EmptyCallOption
+	apply func(*retryOptions)
+}
+
+// WithRetryPolicy overrides the retry policy of a call.
+func WithRetryPolicy(policy backoff.RetryPolicy) grpc.CallOption {
+	return retryCallOption{apply: func(o *retryOptions) { o.policy = policy }}
+}
+
+// WithRetryableCodes overrides the status codes retried for a call.
+func WithRetryableCodes(retryableCodes ...codes.Code) grpc.CallOption {
+	return retryCallOption{apply: func(o *retryOptions) { o.retryableCodes = retryableCodes }}
+}
+
+// WithoutRetries disables retries for a call.
+func WithoutRetries() grpc.CallOption {
+	return WithRetryPolicy(nil)
+}
+
+// options applies the retry options in opts, and removes them.
+func (g *GRPCRetry) options(opts []grpc.CallOption) (retryOptions, []grpc.CallOption) {
+	o := retryOptions{
+		policy:         g.Policy,
+		retryableCodes: g.RetryableCodes,
+	}
+	if o.retryableCodes == nil {
+		o.retryableCodes = DefaultRetryableCodes
+	}
+	filtered := make([]grpc.CallOption, 0, len(opts))
+	for _, opt := range opts {
+		if ro, ok := opt.(retryCallOption); ok {
+			ro.apply(&o)
+		} else {
+			filtered = append(filtered, opt)
+		}
+	}
+	return o, filtered
+}
+
+func (o retryOptions) isRetryable(err error) bool {
+	code := status.Code(err)
+	for _, c := range o.retryableCodes {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
+// do calls op until it succeeds, or it should not be retried.
+func (g *GRPCRetry) do(ctx context.Context, method string, o retryOptions, op func(attempt int) error) error {
+	err := backoff.RetryContext(ctx, func(_ context.Context, attempt int) error {
+		return op(attempt)
+	}, o.policy, o.isRetryable, func(attempt int, err error, next time.Duration) {
+		if g.retries != nil {
+			g.retries.WithLabelValues(method).Inc()
+		}
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.LogKV("event", "retry", "attempt", attempt, "error", err.Error(), "backoff", next.String())
+		}
+	})
+
+	// Return an error gRPC callers understand.
+	var retryErr *backoff.RetryError
+	if !errors.As(err, &retryErr) {
+		return err
+	}
+	if retryErr.Reason == backoff.ContextDone {
+		return status.FromContextError(retryErr.ContextErr).Err()
+	}
+	return retryErr.Unwrap()
+}
+
+// UnaryClientInterceptor retries unary calls.
+func (g *GRPCRetry) UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	o, opts := g.options(opts)
+	if o.policy == nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	return g.do(ctx, method, o, func(int) error {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+}
+
+// StreamClientInterceptor retries server-streaming calls until their first
+// response is received; after that, errors are returned to the caller.  Other
+// kinds of streams are only retried if they cannot be opened.
+func (g *GRPCRetry) StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	o, opts := g.options(opts)
+	if o.policy == nil {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+
+	newStream := func() (grpc.ClientStream, error) {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	var stream grpc.ClientStream
+	err := g.do(ctx, method, o, func(int) error {
+		var err error
+		stream, err = newStream()
+		return err
+	})
+	if err != nil || desc.ClientStreams || !desc.ServerStreams {
+		return stream, err
+	}
+	return &retryingClientStream{
+		stream:    stream,
+		ctx:       ctx,
+		method:    method,
+		retry:     g,
+		options:   o,
+		newStream: newStream,
+	}, nil
+}
+
+// retryingClientStream replays the request of a server-streaming call on a
+// new stream if the first response fails.  The current stream is replaced by
+// reopen, so it is only read with mtx held.
+type retryingClientStream struct {
+	ctx       context.Context
+	method    string
+	retry     *GRPCRetry
+	options   retryOptions
+	newStream func() (grpc.ClientStream, error)
+
+	mtx        sync.Mutex
+	stream     grpc.ClientStream
+	request    interface{}
+	closedSend bool
+	received   bool
+}
+
+func (s *retryingClientStream) current() grpc.ClientStream {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.stream
+}
+
+func (s *retryingClientStream) Header() (metadata.MD, error) {
+	return s.current().Header()
+}
+
+func (s *retryingClientStream) Trailer() metadata.MD {
+	return s.current().Trailer()
+}
+
+func (s *retryingClientStream) Context() context.Context {
+	return s.current().Context()
+}
+
+func (s *retryingClientStream) SendMsg(m interface{}) error {
+	s.mtx.Lock()
+	s.request = m
+	stream := s.stream
+	s.mtx.Unlock()
+	return stream.SendMsg(m)
+}
+
+func (s *retryingClientStream) CloseSend() error {
+	s.mtx.Lock()
+	s.closedSend = true
+	stream := s.stream
+	s.mtx.Unlock()
+	return stream.CloseSend()
+}
+
+func (s *retryingClientStream) RecvMsg(m interface{}) error {
+	s.mtx.Lock()
+	received := s.received
+	s.mtx.Unlock()
+	if received {
+		return s.current().RecvMsg(m)
+	}
+
+	err := s.retry.do(s.ctx, s.method, s.options, func(attempt int) error {
+		if attempt > 1 {
+			if err := s.reopen(); err != nil {
+				return err
+			}
+		}
+		return s.current().RecvMsg(m)
+	})
+	s.mtx.Lock()
+	s.received = true
+	s.mtx.Unlock()
+	return err
+}
+
+// reopen the stream, and send the request again.
+func (s *retryingClientStream) reopen() error {
+	stream, err := s.newStream()
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.stream = stream
+	if s.request != nil {
+		if err := stream.SendMsg(s.request); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	if s.closedSend {
+		return stream.CloseSend()
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/videocoin/common/backoff"
+)
+
+func newTestGRPCRetry(t *testing.T) *GRPCRetry {
+	policy := backoff.NewConstantRetryPolicy(time.Millisecond)
+	policy.SetMaximumAttempts(3)
+	r, err := NewGRPCRetry(policy, prometheus.NewRegistry())
+	require.NoError(t, err)
+	return r
+}
+
+func failingInvoker(errs ...error) (grpc.UnaryInvoker, *int) {
+	calls := 0
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		if calls <= len(errs) {
+			return errs[calls-1]
+		}
+		return nil
+	}, &calls
+}
+
+func TestGRPCRetryUnary(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	notFound := status.Error(codes.NotFound, "not found")
+
+	for _, tc := range []struct {
+		name  string
+		errs  []error
+		opts  []grpc.CallOption
+		err   error
+		calls int
+	}{
+		{name: "success", calls: 1},
+		{name: "retried", errs: []error{unavailable, unavailable}, calls: 3},
+		{name: "exhausted", errs: []error{unavailable, unavailable, unavailable, unavailable}, err: unavailable, calls: 4},
+		{name: "not retryable", errs: []error{notFound}, err: notFound, calls: 1},
+		{name: "retryable codes override", errs: []error{notFound}, opts: []grpc.CallOption{WithRetryableCodes(codes.NotFound)}, calls: 2},
+		{name: "without retries", errs: []error{unavailable}, opts: []grpc.CallOption{WithoutRetries()}, err: unavailable, calls: 1},
+		{name: "policy override", errs: []error{unavailable}, opts: []grpc.CallOption{WithRetryPolicy(backoff.NewConstantRetryPolicy(time.Millisecond))}, calls: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestGRPCRetry(t)
+			invoker, calls := failingInvoker(tc.errs...)
+			err := r.UnaryClientInterceptor(context.Background(), "/test/Method", nil, nil, nil, invoker, tc.opts...)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.calls, *calls)
+			assert.Equal(t, float64(tc.calls-1), testutil.ToFloat64(r.retries.WithLabelValues("/test/Method")))
+		})
+	}
+}
+
+func TestGRPCRetryDeadline(t *testing.T) {
+	policy := backoff.NewConstantRetryPolicy(time.Second)
+	r, err := NewGRPCRetry(policy, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	invoker, calls := failingInvoker(status.Error(codes.Unavailable, "unavailable"))
+	begin := time.Now()
+	err = r.UnaryClientInterceptor(ctx, "/test/Method", nil, nil, nil, invoker)
+	assert.True(t, time.Since(begin) < 500*time.Millisecond)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, 1, *calls)
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	recvErrs []error
+	sent     []interface{}
+	closed   bool
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func (s *fakeClientStream) CloseSend() error {
+	s.closed = true
+	return nil
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if len(s.recvErrs) == 0 {
+		return io.EOF
+	}
+	err := s.recvErrs[0]
+	s.recvErrs = s.recvErrs[1:]
+	return err
+}
+
+func TestGRPCRetryServerStream(t *testing.T) {
+	r := newTestGRPCRetry(t)
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	var streams []*fakeClientStream
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		s := &fakeClientStream{}
+		if len(streams) < 2 {
+			// The first responses fail.
+			s.recvErrs = []error{unavailable}
+		} else {
+			s.recvErrs = []error{nil, unavailable}
+		}
+		streams = append(streams, s)
+		return s, nil
+	}
+
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	stream, err := r.StreamClientInterceptor(context.Background(), desc, nil, "/test/Stream", streamer)
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg("request"))
+	require.NoError(t, stream.CloseSend())
+
+	require.NoError(t, stream.RecvMsg(nil))
+	require.Len(t, streams, 3)
+	for _, s := range streams {
+		assert.Equal(t, []interface{}{"request"}, s.sent)
+		assert.True(t, s.closed)
+	}
+
+	// Errors after the first response are not retried.
+	assert.Equal(t, unavailable, stream.RecvMsg(nil))
+	assert.Len(t, streams, 3)
+	assert.Equal(t, 2.0, testutil.ToFloat64(r.retries.WithLabelValues("/test/Stream")))
+}
+
+func TestGRPCRetrySharesRegistry(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	for i := 0; i < 2; i++ {
+		_, err := NewGRPCRetry(backoff.NewConstantRetryPolicy(time.Millisecond), reg)
+		require.NoError(t, err)
+	}
+
+	r, err := NewGRPCRetry(nil, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, r.retries)
+}
@@ -12,17 +12,31 @@ import (
 	"github.com/videocoin/common/user"
 )
 
-// Log middleware logs http requests
+// RequestIDHeader is the header, or gRPC metadata key, whose value is logged
+// as the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// Log middleware logs http requests.  It also stores a logger with the fields
+// of the request in its context, for handlers to get with logging.FromContext.
 type Log struct {
 	Log                   logging.Interface
 	LogRequestHeaders     bool // LogRequestHeaders true -> dump http headers at debug log level
 	LogRequestAtInfoLevel bool // LogRequestAtInfoLevel true -> log requests at info log level
 	SourceIPs             *SourceIPExtractor
+	RouteMatcher          RouteMatcher      // RouteMatcher set -> log the route name
+	Redactor              *logging.Redactor // Redactor redacts dumped headers, nil -> the defaults
 }
 
 // logWithRequest information from the request and context as fields.
 func (l Log) logWithRequest(r *http.Request) logging.Interface {
-	localLog := l.Log
+	localLog := l.Log.WithField("method", r.Method)
+	if route := getRouteName(l.RouteMatcher, r); route != "" {
+		localLog = localLog.WithField("route", route)
+	}
+	if requestID := r.Header.Get(RequestIDHeader); requestID != "" {
+		localLog = localLog.WithField("requestID", requestID)
+	}
+
 	traceID, ok := tracing.ExtractTraceID(r.Context())
 	if ok {
 		localLog = localLog.WithField("traceID", traceID)
@@ -35,7 +49,21 @@ func (l Log) logWithRequest(r *http.Request) logging.Interface {
 		}
 	}
 
-	return user.LogWith(r.Context(), localLog)
+	// The IDs are usually only put in the context by authentication
+	// middleware running after this one, so fall back to the headers.  The
+	// context of the request is left alone, as they are not authenticated.
+	ctx := r.Context()
+	if _, err := user.ExtractOrgID(ctx); err != nil {
+		if _, headerCtx, err := user.ExtractOrgIDFromHTTPRequest(r); err == nil {
+			ctx = headerCtx
+		}
+	}
+	if _, err := user.ExtractUserID(ctx); err != nil {
+		if userID := r.Header.Get(user.UserIDHeaderName); userID != "" {
+			ctx = user.InjectUserID(ctx, userID)
+		}
+	}
+	return user.LogWith(ctx, localLog)
 }
 
 // Wrap implements Middleware
@@ -44,8 +72,9 @@ func (l Log) Wrap(next http.Handler) http.Handler {
 		begin := time.Now()
 		uri := r.RequestURI // capture the URI before running next, as it may get rewritten
 		requestLog := l.logWithRequest(r)
+		r = r.WithContext(logging.WithContext(r.Context(), requestLog))
 		// Log headers before running 'next' in case other interceptors change the data.
-		headers, err := dumpRequest(r)
+		headers, err := dumpRequest(r, l.Redactor)
 		if err != nil {
 			headers = nil
 			requestLog.Errorf("Could not dump request headers: %v", err)
@@ -95,11 +124,12 @@ var Logging = Log{
 	Log: logging.Global(),
 }
 
-func dumpRequest(req *http.Request) ([]byte, error) {
+func dumpRequest(req *http.Request, redactor *logging.Redactor) ([]byte, error) {
 	var b bytes.Buffer
 
-	// Exclude some headers for security, or just that we don't need them when debugging
-	err := req.Header.WriteSubset(&b, map[string]bool{
+	// Exclude some headers for security, or just that we don't need them when
+	// debugging, and redact the values of the others.
+	err := redactor.Header(req.Header).WriteSubset(&b, map[string]bool{
 		"Cookie":        true,
 		"X-Csrf-Token":  true,
 		"Authorization": true,
@@ -9,9 +9,13 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 	"github.com/videocoin/common/logging"
+	"github.com/videocoin/common/logging/logtest"
+	"github.com/videocoin/common/user"
 )
 
 func TestBadWriteLogging(t *testing.T) {
@@ -59,21 +63,17 @@ func TestBadWriteLogging(t *testing.T) {
 func TestLoggingRequestsAtInfoLevel(t *testing.T) {
 	for _, tc := range []struct {
 		err         error
-		logContains []string
+		logContains string
 	}{{
 		err:         context.Canceled,
-		logContains: []string{"info", "request cancelled: context canceled"},
+		logContains: "request cancelled: context canceled",
 	}, {
 		err:         nil,
-		logContains: []string{"info", "GET http://example.com/foo (200)"},
+		logContains: "GET http://example.com/foo (200)",
 	}} {
-		buf := bytes.NewBuffer(nil)
-		logrusLogger := logrus.New()
-		logrusLogger.Out = buf
-		logrusLogger.Level = logrus.DebugLevel
-
+		log := logtest.New()
 		loggingMiddleware := Log{
-			Log:                   logging.Logrus(logrusLogger),
+			Log:                   log,
 			LogRequestAtInfoLevel: true,
 		}
 		handler := func(w http.ResponseWriter, r *http.Request) {
@@ -90,9 +90,7 @@ func TestLoggingRequestsAtInfoLevel(t *testing.T) {
 		}
 		loggingHandler.ServeHTTP(w, req)
 
-		for _, content := range tc.logContains {
-			require.True(t, bytes.Contains(buf.Bytes(), []byte(content)))
-		}
+		log.AssertLogged(t, logrus.InfoLevel, tc.logContains, logging.Fields{"method": "GET"})
 	}
 }
 
@@ -117,3 +115,56 @@ func (e errorWriter) Write(b []byte) (int, error) {
 
 	return e.w.Write(b)
 }
+
+func TestLoggingContext(t *testing.T) {
+	logrusLogger, hook := test.NewNullLogger()
+	router := mux.NewRouter()
+	router.Path("/api/{org}/foo").Name("foo").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Infoln("handling")
+	})
+	handler := Log{
+		Log:          logging.Logrus(logrusLogger),
+		RouteMatcher: router,
+	}.Wrap(router)
+
+	req := httptest.NewRequest("GET", "http://example.com/api/1/foo", nil)
+	req.Header.Set(user.OrgIDHeaderName, "org")
+	req.Header.Set(user.UserIDHeaderName, "user")
+	req.Header.Set(RequestIDHeader, "id")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	require.Equal(t, "handling", entry.Message)
+	require.Equal(t, logrus.Fields{
+		"method":    "GET",
+		"route":     "foo",
+		"requestID": "id",
+		"orgID":     "org",
+		"userID":    "user",
+	}, entry.Data)
+}
+
+func TestLoggingRedactsHeaders(t *testing.T) {
+	logrusLogger, hook := test.NewNullLogger()
+	logrusLogger.Level = logrus.DebugLevel
+	redactor, err := logging.NewRedactor(logging.RedactConfig{Headers: []string{"X-Api-Key"}})
+	require.NoError(t, err)
+	loggingMiddleware := Log{
+		Log:               logging.Logrus(logrusLogger),
+		LogRequestHeaders: true,
+		Redactor:          redactor,
+	}
+	handler := loggingMiddleware.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("X-Api-Key", "abc")
+	req.Header.Set("X-Forwarded-User", "jane@example.com")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	headers := hook.LastEntry().Message
+	require.NotContains(t, headers, "Authorization")
+	require.Contains(t, headers, "X-Api-Key: REDACTED")
+	require.Contains(t, headers, "X-Forwarded-User: REDACTED")
+}
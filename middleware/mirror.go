@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/videocoin/common/instrument"
+	"github.com/videocoin/common/instrument/registry"
+)
+
+// MirrorConfig configures a Mirror.  MaxBodySize defaults to 1MB if 0.
+type MirrorConfig struct {
+	Percentage     float64       `yaml:"percentage"`
+	MaxBodySize    int64         `yaml:"max_body_size"`
+	MaxConcurrency int           `yaml:"max_concurrency"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *MirrorConfig) RegisterFlags(f *flag.FlagSet) {
+	f.Float64Var(&cfg.Percentage, "mirror.percentage", 0, "Percentage of requests to copy to the shadow backend.")
+	f.Int64Var(&cfg.MaxBodySize, "mirror.max-body-size", 1*mb, "Requests with a larger body (in bytes) are not mirrored.")
+	f.IntVar(&cfg.MaxConcurrency, "mirror.max-concurrency", 100, "Maximum number of mirrored requests in flight; more are dropped. <=0 for no limit.")
+	f.DurationVar(&cfg.Timeout, "mirror.timeout", 30*time.Second, "Timeout for mirrored requests.")
+}
+
+// Mirror is a middleware which asynchronously sends a copy of a percentage
+// of requests to a shadow handler, e.g. an httpgrpc server.Client.  Shadow
+// responses are discarded, and only recorded in the mirror's own metrics.
+type Mirror struct {
+	cfg       MirrorConfig
+	shadow    http.Handler
+	semaphore chan struct{}
+
+	duration *prometheus.HistogramVec
+	dropped  *prometheus.CounterVec
+}
+
+// NewMirror makes a new Mirror, registering its metrics with reg, or the
+// default Prometheus registry if reg is nil.  Mirrors registered with the same
+// reg share their metrics.
+func NewMirror(shadow http.Handler, cfg MirrorConfig, reg prometheus.Registerer) (*Mirror, error) {
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 1 * mb
+	}
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	m := &Mirror{
+		cfg:    cfg,
+		shadow: shadow,
+		duration: registry.RegisterOrGet(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "shadow_request_duration_seconds",
+			Help:    "Time (in seconds) spent serving mirrored requests on the shadow backend.",
+			Buckets: instrument.DefBuckets,
+		}, []string{"method", "status_code"})).(*prometheus.HistogramVec),
+		dropped: registry.RegisterOrGet(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shadow_requests_dropped_total",
+			Help: "Total number of requests which should have been mirrored but were not.",
+		}, []string{"reason"})).(*prometheus.CounterVec),
+	}
+	if cfg.MaxConcurrency > 0 {
+		m.semaphore = make(chan struct{}, cfg.MaxConcurrency)
+	}
+	return m, nil
+}
+
+// Wrap implements Interface
+func (m *Mirror) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64()*100 < m.cfg.Percentage {
+			m.mirror(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *Mirror) mirror(r *http.Request) {
+	// Read one byte more than allowed, to tell whether the body is too big.
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, m.cfg.MaxBodySize+1))
+		// Put back what we read, for the primary handler.
+		r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+		if err != nil {
+			m.dropped.WithLabelValues("body_error").Inc()
+			return
+		}
+		if int64(len(body)) > m.cfg.MaxBodySize {
+			m.dropped.WithLabelValues("body_too_large").Inc()
+			return
+		}
+	}
+
+	if m.semaphore != nil {
+		select {
+		case m.semaphore <- struct{}{}:
+		default:
+			m.dropped.WithLabelValues("concurrency").Inc()
+			return
+		}
+	}
+
+	// The shadow request must outlive the original one, but keep its values
+	// (org ID, trace span...).
+	ctx := context.WithoutCancel(r.Context())
+	cancel := context.CancelFunc(func() {})
+	if m.cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, m.cfg.Timeout)
+	}
+	shadowReq := r.Clone(ctx)
+	shadowReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	shadowReq.ContentLength = int64(len(body))
+
+	go func() {
+		defer cancel()
+		if m.semaphore != nil {
+			defer func() { <-m.semaphore }()
+		}
+
+		begin := time.Now()
+		w := &discardWriter{header: http.Header{}, code: http.StatusOK}
+		m.shadow.ServeHTTP(w, shadowReq)
+		m.duration.WithLabelValues(shadowReq.Method, strconv.Itoa(w.code)).Observe(time.Since(begin).Seconds())
+	}()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// discardWriter is a http.ResponseWriter which only keeps the status code.
+type discardWriter struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code, w.wroteHeader = code, true
+	}
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
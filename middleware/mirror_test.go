@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/videocoin/common/user"
+)
+
+func TestMirror(t *testing.T) {
+	type shadowed struct {
+		body  string
+		orgID string
+		err   error
+	}
+	received := make(chan shadowed, 1)
+	shadow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		orgID, _ := user.ExtractOrgID(r.Context())
+		// The shadow request must not be cancelled with the original one.
+		time.Sleep(10 * time.Millisecond)
+		received <- shadowed{body: string(body), orgID: orgID, err: r.Context().Err()}
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	reg := prometheus.NewPedanticRegistry()
+	m, err := NewMirror(shadow, MirrorConfig{Percentage: 100, MaxBodySize: 1024}, reg)
+	require.NoError(t, err)
+
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	ctx, cancel := context.WithCancel(user.InjectOrgID(context.Background(), "1"))
+	req := httptest.NewRequest("POST", "/foo", bytes.NewBufferString("hello")).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	cancel()
+
+	assert.Equal(t, "hello", recorder.Body.String())
+	assert.Equal(t, shadowed{body: "hello", orgID: "1"}, <-received)
+
+	assert.Eventually(t, func() bool {
+		n, err := testutil.GatherAndCount(reg, "shadow_request_duration_seconds")
+		return err == nil && n == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMirrorDrops(t *testing.T) {
+	release := make(chan struct{})
+	shadow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	defer close(release)
+
+	m, err := NewMirror(shadow, MirrorConfig{Percentage: 100, MaxBodySize: 4, MaxConcurrency: 1}, prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	for _, body := range []string{"one", "two", "too large"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/foo", bytes.NewBufferString(body)))
+		// The primary always gets the whole body.
+		assert.Equal(t, body, recorder.Body.String())
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.dropped.WithLabelValues("concurrency")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.dropped.WithLabelValues("body_too_large")))
+}
+
+func TestMirrorDefaultMaxBodySize(t *testing.T) {
+	mirrored := make(chan string, 1)
+	shadow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mirrored <- string(body)
+	})
+
+	// A zero MaxBodySize, e.g. from a struct literal, still mirrors bodies.
+	m, err := NewMirror(shadow, MirrorConfig{Percentage: 100}, prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/foo", bytes.NewBufferString("body")))
+
+	select {
+	case body := <-mirrored:
+		assert.Equal(t, "body", body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
+
+func TestMirrorsShareRegistry(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	for i := 0; i < 2; i++ {
+		_, err := NewMirror(http.NotFoundHandler(), MirrorConfig{Percentage: 100}, reg)
+		require.NoError(t, err)
+	}
+}
@@ -108,13 +108,16 @@ type Config struct {
 	GRPCServerMinTimeBetweenPings      time.Duration `yaml:"grpc_server_min_time_between_pings"`
 	GRPCServerPingWithoutStreamAllowed bool          `yaml:"grpc_server_ping_without_stream_allowed"`
 
-	LogFormat             logging.Format    `yaml:"log_format"`
-	LogLevel              logging.Level     `yaml:"log_level"`
-	Log                   logging.Interface `yaml:"-"`
-	LogSourceIPs          bool              `yaml:"log_source_ips_enabled"`
-	LogSourceIPsHeader    string            `yaml:"log_source_ips_header"`
-	LogSourceIPsRegex     string            `yaml:"log_source_ips_regex"`
-	LogRequestAtInfoLevel bool              `yaml:"log_request_at_info_level_enabled"`
+	LogFormat             logging.Format         `yaml:"log_format"`
+	LogLevel              logging.Level          `yaml:"log_level"`
+	LogLevels             logging.Levels         `yaml:"log_levels"`
+	LogSampling           logging.SamplingConfig `yaml:"log_sampling"`
+	LogRedact             logging.RedactConfig   `yaml:"log_redact"`
+	Log                   logging.Interface      `yaml:"-"`
+	LogSourceIPs          bool                   `yaml:"log_source_ips_enabled"`
+	LogSourceIPsHeader    string                 `yaml:"log_source_ips_header"`
+	LogSourceIPsRegex     string                 `yaml:"log_source_ips_regex"`
+	LogRequestAtInfoLevel bool                   `yaml:"log_request_at_info_level_enabled"`
 
 	// If not set, default signal handler is used.
 	SignalHandler SignalHandler `yaml:"-"`
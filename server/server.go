@@ -88,6 +88,9 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.PathPrefix, "server.path-prefix", "", "Base path to serve all API routes from (e.g. /v1/)")
 	cfg.LogFormat.RegisterFlags(f)
 	cfg.LogLevel.RegisterFlags(f)
+	cfg.LogLevels.RegisterFlags(f)
+	cfg.LogSampling.RegisterFlags(f)
+	cfg.LogRedact.RegisterFlags(f)
 	f.BoolVar(&cfg.LogSourceIPs, "server.log-source-ips-enabled", false, "Optionally log the source IPs.")
 	f.StringVar(&cfg.LogSourceIPsHeader, "server.log-source-ips-header", "", "Header field storing the source IPs. Only used if server.log-source-ips-enabled is true. If not set the default Forwarded, X-Real-IP and X-Forwarded-For headers are used")
 	f.StringVar(&cfg.LogSourceIPsRegex, "server.log-source-ips-regex", "", "Regex for matching the source IPs. Only used if server.log-source-ips-enabled is true. If not set the default Forwarded, X-Real-IP and X-Forwarded-For headers are used")
@@ -107,6 +110,9 @@ type Server struct {
 	HTTPServer *http.Server
 	GRPC       *grpc.Server
 	Log        logging.Interface
+	// LogLevels changes the levels of Log at runtime.  It is nil if Log was
+	// given in the Config.
+	LogLevels  *logging.Leveled
 	Registerer prometheus.Registerer
 	Gatherer   prometheus.Gatherer
 }
@@ -158,18 +164,33 @@ func New(cfg Config) (*Server, error) {
 		grpcListener = netutil.LimitListener(grpcListener, cfg.GRPCConnLimit)
 	}
 
-	// If user doesn't supply a logging implementation, by default instantiate
-	// logrus.
-	log := cfg.Log
-	if log == nil {
-		log = logging.NewLogrus(cfg.LogLevel)
-	}
-
 	// If user doesn't supply a registerer/gatherer, use Prometheus' by default.
 	reg := cfg.Registerer
 	if reg == nil {
 		reg = prometheus.DefaultRegisterer
 	}
+
+	// If user doesn't supply a logging implementation, by default instantiate
+	// logrus, filtered by the levels of named loggers and optionally sampled.
+	redactor := logging.NoopRedactor()
+	if cfg.LogRedact.Enabled {
+		redactor, err = logging.NewRedactor(cfg.LogRedact)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// It is also made the global logger, so that the levels of named loggers
+	// derived from the global one apply too.
+	log := cfg.Log
+	var leveled *logging.Leveled
+	if log == nil {
+		var all logging.Level
+		_ = all.Set("debug")
+		redacted := logging.NewRedacting(logging.NewLogrusFormat(all, cfg.LogFormat), redactor)
+		leveled = logging.NewLeveled(logging.NewSampling(redacted, cfg.LogSampling, reg), cfg.LogLevel, cfg.LogLevels)
+		log = leveled
+		logging.SetGlobal(log)
+	}
 	gatherer := cfg.Gatherer
 	if gatherer == nil {
 		gatherer = prometheus.DefaultGatherer
@@ -231,17 +252,19 @@ func New(cfg Config) (*Server, error) {
 	serverLog := middleware.GRPCServerLog{
 		WithRequest: !cfg.ExcludeRequestInLog,
 		Log:         log,
+		Redactor:    redactor,
 	}
+	// Tracing goes first, so that request loggers have the trace ID.
 	grpcMiddleware := []grpc.UnaryServerInterceptor{
-		serverLog.UnaryServerInterceptor,
 		otgrpc.OpenTracingServerInterceptor(opentracing.GlobalTracer()),
+		serverLog.UnaryServerInterceptor,
 		middleware.UnaryServerInstrumentInterceptor(requestDuration),
 	}
 	grpcMiddleware = append(grpcMiddleware, cfg.GRPCMiddleware...)
 
 	grpcStreamMiddleware := []grpc.StreamServerInterceptor{
-		serverLog.StreamServerInterceptor,
 		otgrpc.OpenTracingStreamServerInterceptor(opentracing.GlobalTracer()),
+		serverLog.StreamServerInterceptor,
 		middleware.StreamServerInstrumentInterceptor(requestDuration),
 	}
 	grpcStreamMiddleware = append(grpcStreamMiddleware, cfg.GRPCStreamMiddleware...)
@@ -313,6 +336,8 @@ func New(cfg Config) (*Server, error) {
 			Log:                   log,
 			SourceIPs:             sourceIPs,
 			LogRequestAtInfoLevel: cfg.LogRequestAtInfoLevel,
+			RouteMatcher:          router,
+			Redactor:              redactor,
 		},
 		middleware.Instrument{
 			RouteMatcher:     router,
@@ -354,6 +379,7 @@ func New(cfg Config) (*Server, error) {
 		HTTPServer: httpServer,
 		GRPC:       grpcServer,
 		Log:        log,
+		LogLevels:  leveled,
 		Registerer: reg,
 		Gatherer:   gatherer,
 	}, nil
@@ -404,7 +430,9 @@ func (s *Server) Run() error {
 
 	// Setup gRPC server
 	// for HTTP over gRPC, ensure we don't double-count the middleware
-	httpgrpc.RegisterHTTPServer(s.GRPC, httpgrpc_server.NewServer(s.HTTP))
+	httpgrpcServer := httpgrpc_server.NewServer(s.HTTP)
+	httpgrpc.RegisterHTTPServer(s.GRPC, httpgrpcServer)
+	httpgrpc.RegisterHTTPTunnelServer(s.GRPC, httpgrpcServer)
 
 	go func() {
 		err := s.GRPC.Serve(s.grpcListener)
@@ -23,6 +23,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/exporter-toolkit/web"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/videocoin/common/httpgrpc"
 	"github.com/videocoin/common/logging"
@@ -495,9 +496,19 @@ func TestMiddlewareLogging(t *testing.T) {
 		DoNotAddDefaultHTTPMiddleware: true,
 		Router:                        &mux.Router{},
 	}
+	defer logging.SetGlobal(logging.Global())
 	server, err := New(cfg)
 	require.NoError(t, err)
 
+	// The default logger is made the global one, so that the levels set at
+	// runtime apply to named loggers derived from it.
+	require.NotNil(t, server.LogLevels)
+	assert.Equal(t, server.Log, logging.Global())
+	var debug logging.Level
+	require.NoError(t, debug.Set("debug"))
+	server.LogLevels.SetLevel("httpgrpc", debug)
+	assert.Equal(t, debug.Logrus, server.LogLevels.Level("httpgrpc"))
+
 	server.HTTP.HandleFunc("/error500", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(500)
 	})